@@ -1,10 +1,17 @@
 package chronic
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"os/signal"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"gabe565.com/moreutils/internal/cmdutil"
 	"gabe565.com/moreutils/internal/execbuf"
@@ -17,12 +24,76 @@ const (
 	Name        = "chronic"
 	FlagStderr  = "stderr"
 	FlagVerbose = "verbose"
+
+	FlagTailLines = "tail-lines"
+	FlagTailBytes = "tail-bytes"
+
+	FlagSuccessCodes = "success-codes"
+	FlagStdoutMatch  = "stdout-match"
+	FlagIgnoreStderr = "ignore-stderr"
+	FlagMaxRuntime   = "max-runtime"
+
+	FlagReplay = "replay"
+
+	FlagNotify     = "notify"
+	FlagNotifyOnly = "notify-only"
+
+	FlagTimeout   = "timeout"
+	FlagKillAfter = "kill-after"
+
+	FlagPTY = "pty"
 )
 
 func New(opts ...cobrax.Option) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     Name + " [flags] command",
-		Short:   "Runs a command quietly unless it fails",
+		Use:   Name + " [flags] command",
+		Short: "Runs a command quietly unless it fails",
+		Long: `Runs a command quietly unless it fails.
+
+Output is held in memory up to a limit, then spilled to a temp file, so commands
+with unbounded output are safe to run. Use --tail-lines or --tail-bytes to only
+keep the end of the output.
+
+Output is shown if the exit code is not one of --success-codes. Otherwise, it is
+also shown if any of these conditions are met:
+  - --stderr is given and stderr is not empty
+  - --ignore-stderr is given and a stderr line does not match it
+  - --stdout-match is given and a stdout line matches it
+  - --max-runtime is given and the command runs for longer
+
+If a non-zero exit code is a success code, chronic exits with 0.
+
+With --replay, stdout and stderr are printed to stdout as a single transcript in
+the order they were written. Each line is prefixed with the time it was written,
+relative to the start of the command or as an absolute time, and an "out" or
+"err" tag:
+  +0.001234s out | starting backup
+  +2.345678s err | error: disk full
+
+With --notify, a JSON report with the command, hostname, reason, exit code,
+start time, duration, and captured stdout and stderr is sent whenever output is
+shown. Only the last 1 MiB of each stream is included, and the report marks
+streams which were cut. Targets in the form "scheme:address" are written to directly:
+  - file:PATH writes the report to a file, replacing its contents
+  - append:PATH appends the report to a file as a single line
+  - unix:PATH connects to a Unix socket
+Anything else is run with "sh -c", with the report on stdin:
+  chronic --notify 'curl -sS --json @- https://example.com/hook' backup.sh
+
+The reason is one of timeout, exit-code, stderr, stdout-match, or max-runtime.
+
+The command is run in its own process group. SIGINT, SIGTERM, SIGHUP, SIGQUIT,
+SIGTSTP, and SIGCONT received by chronic are forwarded to the group. If stdin
+is a terminal, the command instead stays in the terminal's foreground process
+group so that it can read from it. Keyboard signals then reach the command
+directly, so SIGINT, SIGQUIT, and SIGTSTP are not forwarded. With --timeout, the
+group is sent SIGTERM once the timeout is reached, and SIGKILL if it is still
+running after --kill-after. Output captured before the timeout is shown.
+
+With --pty, the command's stdout is a pseudo-terminal, so it writes output a
+line at a time as it would in an interactive run, and the order of stdout and
+stderr lines matches what would have been seen in a terminal. Stderr is still
+captured separately.`,
 		Args:    cobra.MinimumNArgs(1),
 		RunE:    run,
 		GroupID: cmdutil.Applet,
@@ -32,9 +103,27 @@ func New(opts ...cobrax.Option) *cobra.Command {
 
 	cmd.Flags().SetInterspersed(false)
 	cmd.Flags().BoolP(FlagStderr, "e", false, "Triggers output when stderr output length is non-zero")
+	cmd.Flags().String(FlagIgnoreStderr, "", "Ignore stderr lines matching a regex (implies --stderr)")
+	cmd.Flags().String(FlagStdoutMatch, "", "Triggers output when a stdout line matches a regex")
+	cmd.Flags().Duration(FlagMaxRuntime, 0, "Triggers output when the command runs for longer than a duration")
+	cmd.Flags().IntSlice(FlagSuccessCodes, []int{0}, "Exit codes which are not failures")
 	cmd.Flags().BoolP(FlagVerbose, "v", false,
 		"Verbose output (distinguishes between STDOUT and STDERR, also reports RETVAL)",
 	)
+	cmd.Flags().StringP(FlagReplay, "r", "",
+		"Print merged output with a timestamp and out or err tag on each line (one of "+strings.Join(replayFormatStrings(), ", ")+")",
+	)
+	cmd.Flags().Lookup(FlagReplay).NoOptDefVal = replayRelative.String()
+	must.Must(cmd.RegisterFlagCompletionFunc(FlagReplay,
+		cobra.FixedCompletions(replayFormatStrings(), cobra.ShellCompDirectiveNoFileComp),
+	))
+	cmd.Flags().StringArray(FlagNotify, nil, "Send a JSON report to a command or target when output is shown (repeatable)")
+	cmd.Flags().Bool(FlagNotifyOnly, false, "Send reports without printing output")
+	cmd.Flags().Duration(FlagTimeout, 0, "Terminate the command if it runs for longer than a duration")
+	cmd.Flags().Duration(FlagKillAfter, 10*time.Second, "Kill the command if it is still running this long after being terminated")
+	cmd.Flags().Bool(FlagPTY, false, "Connect the command's stdout to a pseudo-terminal and record output a line at a time")
+	cmd.Flags().Int64(FlagTailLines, 0, "Only keep the last N lines of output. 0 keeps everything.")
+	cmd.Flags().Int64(FlagTailBytes, 0, "Only keep the last N bytes of output. 0 keeps everything.")
 
 	for _, opt := range opts {
 		opt(cmd)
@@ -45,40 +134,239 @@ func New(opts ...cobrax.Option) *cobra.Command {
 func run(cmd *cobra.Command, args []string) error {
 	cmd.SilenceUsage = true
 
-	onStderr := must.Must2(cmd.Flags().GetBool(FlagStderr))
-	verbose := must.Must2(cmd.Flags().GetBool(FlagVerbose))
+	p, err := loadPrinter(cmd)
+	if err != nil {
+		return err
+	}
 
-	e := exec.CommandContext(cmd.Context(), args[0], args[1:]...)
-	e.Stdin = cmd.InOrStdin()
+	cond, err := loadConditions(cmd)
+	if err != nil {
+		return err
+	}
+
+	targets := must.Must2(cmd.Flags().GetStringArray(FlagNotify))
+	notifiers := make([]notifier, 0, len(targets))
+	for _, target := range targets {
+		notifiers = append(notifiers, parseNotifier(target, cmd.OutOrStdout(), cmd.ErrOrStderr()))
+	}
+
+	bufOpts := []execbuf.Option{
+		execbuf.WithTailLines(must.Must2(cmd.Flags().GetInt64(FlagTailLines))),
+		execbuf.WithTailBytes(must.Must2(cmd.Flags().GetInt64(FlagTailBytes))),
+	}
+	if must.Must2(cmd.Flags().GetBool(FlagPTY)) {
+		bufOpts = append(bufOpts, execbuf.WithLines())
+	}
+	buf := execbuf.New(bufOpts...)
+	defer func() {
+		_ = buf.Close()
+	}()
 
-	buf, err := execbuf.RunBuffered(e, cmd.OutOrStdout(), cmd.ErrOrStderr())
+	res, err := runBuffered(cmd, args, buf, cond)
 	if err != nil {
-		if exitErr, ok := errors.AsType[*exec.ExitError](err); ok {
-			if printErr := printBuf(cmd, buf, exitErr.ExitCode(), verbose); printErr != nil {
-				err = errors.Join(err, printErr)
-			}
-		}
 		return err
 	}
+	if p.replay != nil {
+		p.replay.start = res.start
+	}
+
+	reason := cond.reason(res)
+	if reason == "" {
+		return nil
+	}
 
-	if onStderr && buf.Len(cmd.ErrOrStderr()) != 0 {
-		return printBuf(cmd, buf, 0, verbose)
+	// Exit codes which are success codes are not reported, even if another condition shows output
+	errs := make([]error, 1)
+	switch {
+	case reason == ReasonTimeout:
+		errs[0] = fmt.Errorf("%w after %s", ErrTimeout, must.Must2(cmd.Flags().GetDuration(FlagTimeout)))
+	case reason == ReasonExitCode && res.err == nil:
+		errs[0] = fmt.Errorf("%w: %d", ErrNotSuccess, res.exitCode)
+	case reason == ReasonExitCode:
+		errs[0] = res.err
+	}
+	if !must.Must2(cmd.Flags().GetBool(FlagNotifyOnly)) {
+		errs = append(errs, p.print(cmd, buf, res.exitCode))
+	}
+	if len(notifiers) != 0 {
+		r := report{
+			Command:  args,
+			Reason:   reason,
+			ExitCode: res.exitCode,
+			Start:    res.start,
+			Duration: res.runtime.Seconds(),
+		}
+		var err error
+		if r.Stdout, r.StdoutTruncated, err = reportOutput(buf, cmd.OutOrStdout()); err == nil {
+			r.Stderr, r.StderrTruncated, err = reportOutput(buf, cmd.ErrOrStderr())
+		}
+		if err == nil {
+			err = notify(cmd.Context(), targets, notifiers, r)
+		}
+		errs = append(errs, err)
 	}
+	return errors.Join(errs...)
+}
 
-	return nil
+// result describes a finished command.
+type result struct {
+	exitCode int
+	start    time.Time
+	runtime  time.Duration
+	timedOut bool
+	// err is the command's *exec.ExitError, if any.
+	err error
 }
 
-func printBuf(cmd *cobra.Command, buf *execbuf.Buffer, exitCode int, verbose bool) error {
-	if !verbose {
-		return buf.Print(nil)
+// runBuffered runs a command, writing its output to buf and the condition matchers.
+// Signals received by chronic are forwarded to the command's process group.
+// It returns an error if the command could not be run.
+func runBuffered(cmd *cobra.Command, args []string, buf *execbuf.Buffer, cond conditions) (result, error) {
+	timeout := must.Must2(cmd.Flags().GetDuration(FlagTimeout))
+	killAfter := must.Must2(cmd.Flags().GetDuration(FlagKillAfter))
+
+	ctx := cmd.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
+	e := exec.CommandContext(ctx, args[0], args[1:]...)
+	e.Stdin = cmd.InOrStdin()
+	var stdout io.Writer = buf.Writer(cmd.OutOrStdout())
+	if cond.stdout != nil {
+		stdout = io.MultiWriter(stdout, cond.stdout)
+	}
+	e.Stderr = buf.Writer(cmd.ErrOrStderr())
+	if cond.stderr != nil {
+		e.Stderr = io.MultiWriter(e.Stderr, cond.stderr)
+	}
+	group := setProcessGroup(e)
+
+	// Terminate the process group on timeout, then kill it after the grace period
+	var kill *time.Timer
+	e.Cancel = func() error {
+		kill = time.AfterFunc(killAfter, func() {
+			_ = signalGroup(e.Process, os.Kill, group)
+		})
+		return signalGroup(e.Process, terminateSignal, group)
+	}
+	e.WaitDelay = killAfter
+
+	res := result{start: time.Now()}
+	wait := func() error { return nil }
+	if must.Must2(cmd.Flags().GetBool(FlagPTY)) {
+		// The command leads a new session, and so its own process group
+		group = true
+		var err error
+		if wait, err = execbuf.StartPTY(e, stdout); err != nil {
+			return res, err
+		}
+	} else {
+		e.Stdout = stdout
+		if err := e.Start(); err != nil {
+			return res, err
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardSignals...)
+	go func() {
+		for sig := range signals {
+			_ = forwardSignal(e.Process, sig, group)
+		}
+	}()
+
+	err := e.Wait()
+	if waitErr := wait(); err == nil {
+		err = waitErr
+	}
+	signal.Stop(signals)
+	close(signals)
+	if kill != nil {
+		kill.Stop()
+	}
+
+	res.runtime = time.Since(res.start)
+	res.timedOut = timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if err != nil {
+		exitErr, ok := errors.AsType[*exec.ExitError](err)
+		switch {
+		case ok:
+			res.exitCode, res.err = exitErr.ExitCode(), err
+		case !res.timedOut:
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// loadPrinter reads the options which decide how output is printed.
+func loadPrinter(cmd *cobra.Command) (printer, error) {
+	p := printer{
+		verbose: must.Must2(cmd.Flags().GetBool(FlagVerbose)),
+	}
+	if name := must.Must2(cmd.Flags().GetString(FlagReplay)); name != "" {
+		format, err := replayFormatString(name)
+		if err != nil {
+			return p, fmt.Errorf("%w: %q", ErrInvalidReplay, name)
+		}
+		p.replay = &replayer{w: cmd.OutOrStdout(), stdout: cmd.OutOrStdout(), format: format}
+	}
+	return p, nil
+}
+
+// loadConditions reads the conditions which decide whether output is shown.
+func loadConditions(cmd *cobra.Command) (conditions, error) {
+	cond := conditions{
+		successCodes: must.Must2(cmd.Flags().GetIntSlice(FlagSuccessCodes)),
+		maxRuntime:   must.Must2(cmd.Flags().GetDuration(FlagMaxRuntime)),
+	}
+
+	if v := must.Must2(cmd.Flags().GetString(FlagStdoutMatch)); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return cond, fmt.Errorf("--%s: %w", FlagStdoutMatch, err)
+		}
+		cond.stdout = &lineMatcher{re: re}
+	}
+
+	if v := must.Must2(cmd.Flags().GetString(FlagIgnoreStderr)); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return cond, fmt.Errorf("--%s: %w", FlagIgnoreStderr, err)
+		}
+		cond.stderr = &lineMatcher{re: re, invert: true}
+	} else if must.Must2(cmd.Flags().GetBool(FlagStderr)) {
+		cond.stderr = &lineMatcher{}
+	}
+	return cond, nil
+}
+
+// printer prints buffered output.
+type printer struct {
+	verbose bool
+	replay  *replayer
+}
+
+func (p printer) print(cmd *cobra.Command, buf *execbuf.Buffer, exitCode int) error {
 	errs := make([]error, 0, 2)
-	_, _ = fmt.Fprintln(cmd.OutOrStdout(), "STDOUT:")
-	errs = append(errs, buf.Print(cmd.OutOrStdout()))
-	_, _ = fmt.Fprintln(cmd.OutOrStdout(), "\nSTDERR:")
-	errs = append(errs, buf.Print(cmd.ErrOrStderr()))
+	switch {
+	case p.replay != nil:
+		errs = append(errs, p.replay.replay(buf))
+	case !p.verbose:
+		return buf.Print(nil)
+	default:
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "STDOUT:")
+		errs = append(errs, buf.Print(cmd.OutOrStdout()))
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "\nSTDERR:")
+		errs = append(errs, buf.Print(cmd.ErrOrStderr()))
+		_, _ = fmt.Fprintln(cmd.OutOrStdout())
+	}
 
-	_, _ = fmt.Fprintln(cmd.OutOrStdout(), "\nRETVAL:", strconv.Itoa(exitCode))
+	if p.verbose {
+		_, _ = fmt.Fprintln(cmd.OutOrStdout(), "RETVAL:", strconv.Itoa(exitCode))
+	}
 	return errors.Join(errs...)
 }
@@ -1,9 +1,17 @@
 package chronic
 
 import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"gabe565.com/moreutils/internal/execbuf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -44,6 +52,83 @@ func TestChronic(t *testing.T) {
 			"stderr\nError: exit status 1\n",
 			require.Error,
 		},
+		{
+			"flag tail lines",
+			[]string{"--tail-lines=2", "sh", "-c", "echo 1; echo 2; echo 3; exit 1;"},
+			"2\n3\n",
+			"Error: exit status 1\n",
+			require.Error,
+		},
+		{
+			"flag tail bytes",
+			[]string{"--tail-bytes=3", "sh", "-c", "echo 123; echo 456; exit 1;"},
+			"56\n",
+			"Error: exit status 1\n",
+			require.Error,
+		},
+		{
+			"flag success codes",
+			[]string{"--success-codes=0,3", "sh", "-c", "echo stdout; exit 3;"},
+			"",
+			"",
+			require.NoError,
+		},
+		{
+			"flag success codes with other condition",
+			[]string{"--success-codes=0,1", "--stderr", "sh", "-c", "echo stderr >&2; exit 1;"},
+			"",
+			"stderr\n",
+			require.NoError,
+		},
+		{
+			"flag success codes zero",
+			[]string{"--success-codes=1", "sh", "-c", "echo stdout;"},
+			"stdout\n",
+			"Error: exit status is not a success code: 0\n",
+			require.Error,
+		},
+		{
+			"flag stdout match",
+			[]string{"--stdout-match=^WARN", "sh", "-c", "echo ok; echo WARN: disk"},
+			"ok\nWARN: disk\n",
+			"",
+			require.NoError,
+		},
+		{
+			"flag stdout match no match",
+			[]string{"--stdout-match=^WARN", "sh", "-c", "echo ok; echo INFO: WARN"},
+			"",
+			"",
+			require.NoError,
+		},
+		{
+			"flag ignore stderr",
+			[]string{"--ignore-stderr=^deprecated", "sh", "-c", "echo stdout; echo deprecated >&2"},
+			"",
+			"",
+			require.NoError,
+		},
+		{
+			"flag ignore stderr other line",
+			[]string{"--ignore-stderr=^deprecated", "sh", "-c", "echo deprecated >&2; printf oops >&2"},
+			"",
+			"deprecated\noops",
+			require.NoError,
+		},
+		{
+			"flag max runtime",
+			[]string{"--max-runtime=1ms", "sh", "-c", "sleep 0.1; echo slow"},
+			"slow\n",
+			"",
+			require.NoError,
+		},
+		{
+			"invalid regex",
+			[]string{"--stdout-match=(", "true"},
+			"",
+			"Error: --stdout-match: error parsing regexp: missing closing ): `(`\n",
+			require.Error,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -59,3 +144,209 @@ func TestChronic(t *testing.T) {
 		})
 	}
 }
+
+func TestChronicReplay(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantStdout string
+	}{
+		{
+			"relative",
+			[]string{"--replay"},
+			`^\+0\.\d{6}s out \| one\n\+0\.\d{6}s err \| two\n\+0\.\d{6}s out \| three\n$`,
+		},
+		{
+			"absolute",
+			[]string{"--replay=absolute"},
+			`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}\S+ out \| one\n\S+ err \| two\n\S+ out \| three\n$`,
+		},
+		{
+			"verbose",
+			[]string{"--replay", "--verbose"},
+			`^\S+ out \| one\n\S+ err \| two\n\S+ out \| three\nRETVAL: 1\n$`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := New()
+			cmd.SetArgs(append(tt.args,
+				"sh", "-c", "echo one; sleep 0.05; echo two >&2; sleep 0.05; printf three; exit 1",
+			))
+			var stdout strings.Builder
+			cmd.SetOut(&stdout)
+			var stderr strings.Builder
+			cmd.SetErr(&stderr)
+			require.Error(t, cmd.Execute())
+			assert.Regexp(t, tt.wantStdout, stdout.String())
+			assert.Equal(t, "Error: exit status 1\n", stderr.String())
+		})
+	}
+}
+
+func TestChronicNotify(t *testing.T) {
+	readReport := func(t *testing.T, data []byte) report {
+		var r report
+		require.NoError(t, json.Unmarshal(data, &r))
+		return r
+	}
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		cmd := New()
+		cmd.SetArgs([]string{"--notify=file:" + path, "sh", "-c", "echo stdout; echo stderr >&2; exit 2"})
+		var stdout strings.Builder
+		cmd.SetOut(&stdout)
+		cmd.SetErr(io.Discard)
+		require.Error(t, cmd.Execute())
+		assert.Equal(t, "stdout\n", stdout.String())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		r := readReport(t, data)
+		assert.Equal(t, []string{"sh", "-c", "echo stdout; echo stderr >&2; exit 2"}, r.Command)
+		assert.Equal(t, ReasonExitCode, r.Reason)
+		assert.Equal(t, 2, r.ExitCode)
+		assert.Equal(t, "stdout\n", r.Stdout)
+		assert.Equal(t, "stderr\n", r.Stderr)
+		assert.NotZero(t, r.Start)
+		assert.Positive(t, r.Duration)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		cmd := New()
+		cmd.SetArgs([]string{"--notify=file:" + path, "--notify-only", "sh", "-c", "head -c 1100000 /dev/zero | tr '\\0' a; echo end; exit 1"})
+		cmd.SetOut(&strings.Builder{})
+		cmd.SetErr(&strings.Builder{})
+		require.Error(t, cmd.Execute())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		r := readReport(t, data)
+		assert.Len(t, r.Stdout, maxReportOutput)
+		assert.True(t, strings.HasSuffix(r.Stdout, "aaaend\n"))
+		assert.True(t, r.StdoutTruncated)
+		assert.False(t, r.StderrTruncated)
+	})
+
+	t.Run("command notify only", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		cmd := New()
+		cmd.SetArgs([]string{"--notify-only", "--stderr", "--notify=cat > " + path, "sh", "-c", "echo stderr >&2"})
+		var stdout, stderr strings.Builder
+		cmd.SetOut(&stdout)
+		cmd.SetErr(&stderr)
+		require.NoError(t, cmd.Execute())
+		assert.Empty(t, stdout.String())
+		assert.Empty(t, stderr.String())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		r := readReport(t, data)
+		assert.Equal(t, ReasonStderr, r.Reason)
+		assert.Equal(t, "stderr\n", r.Stderr)
+	})
+
+	t.Run("unix", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "sock")
+		l, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+
+		received := make(chan []byte, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			_ = conn.Close()
+			received <- data
+		}()
+
+		cmd := New()
+		cmd.SetArgs([]string{"--notify=unix:" + path, "--notify-only", "false"})
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		require.Error(t, cmd.Execute())
+		assert.Equal(t, 1, readReport(t, <-received).ExitCode)
+	})
+
+	t.Run("quiet", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		cmd := New()
+		cmd.SetArgs([]string{"--notify=file:" + path, "true"})
+		require.NoError(t, cmd.Execute())
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		cmd := New()
+		cmd.SetArgs([]string{"--notify=exit 3", "--notify-only", "false"})
+		var stderr strings.Builder
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(&stderr)
+		require.Error(t, cmd.Execute())
+		assert.Equal(t, "Error: exit status 1\nnotify \"exit 3\": exit status 3\n", stderr.String())
+	})
+}
+
+func TestChronicTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantStdout string
+	}{
+		{
+			"terminate",
+			[]string{"--timeout=100ms", "sh", "-c", `trap "echo terminated; exit 3" TERM; echo start; sleep 5; echo done`},
+			"start\nterminated\n",
+		},
+		{
+			"kill",
+			[]string{"--timeout=100ms", "--kill-after=100ms", "sh", "-c", `trap "" TERM; echo start; sleep 5; echo done`},
+			"start\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := New()
+			cmd.SetArgs(tt.args)
+			var stdout strings.Builder
+			cmd.SetOut(&stdout)
+			var stderr strings.Builder
+			cmd.SetErr(&stderr)
+
+			start := time.Now()
+			err := cmd.Execute()
+			require.ErrorIs(t, err, ErrTimeout)
+			assert.Less(t, time.Since(start), 2*time.Second)
+			assert.Equal(t, tt.wantStdout, stdout.String())
+		})
+	}
+
+	t.Run("finished", func(t *testing.T) {
+		cmd := New()
+		cmd.SetArgs([]string{"--timeout=5s", "sh", "-c", "echo stdout"})
+		var stdout strings.Builder
+		cmd.SetOut(&stdout)
+		require.NoError(t, cmd.Execute())
+		assert.Empty(t, stdout.String())
+	})
+}
+
+func TestChronicPTY(t *testing.T) {
+	cmd := New()
+	cmd.SetArgs([]string{"--pty", "--replay", "sh", "-c", `[ -t 1 ] && echo tty; sleep 0.05; echo stderr >&2; sleep 0.05; printf partial; exit 1`})
+	var stdout strings.Builder
+	cmd.SetOut(&stdout)
+	var stderr strings.Builder
+	cmd.SetErr(&stderr)
+	err := cmd.Execute()
+	if errors.Is(err, execbuf.ErrPTYUnsupported) {
+		t.Skip(err)
+	}
+	require.Error(t, err)
+	assert.Regexp(t, `^\S+ out \| tty\n\S+ err \| stderr\n\S+ out \| partial\n$`, stdout.String())
+}
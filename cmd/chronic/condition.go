@@ -0,0 +1,95 @@
+package chronic
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"slices"
+	"time"
+)
+
+var (
+	ErrNotSuccess = errors.New("exit status is not a success code")
+	ErrTimeout    = errors.New("command timed out")
+)
+
+// conditions decide whether a command's output is shown.
+type conditions struct {
+	// successCodes are the exit codes which are not failures.
+	successCodes []int
+	// stdout shows output if a stdout line matches.
+	stdout *lineMatcher
+	// stderr shows output if a stderr line is not ignored.
+	stderr *lineMatcher
+	// maxRuntime shows output if the command runs for longer.
+	maxRuntime time.Duration
+}
+
+// Reasons for showing output.
+const (
+	ReasonTimeout     = "timeout"
+	ReasonExitCode    = "exit-code"
+	ReasonStderr      = "stderr"
+	ReasonStdoutMatch = "stdout-match"
+	ReasonMaxRuntime  = "max-runtime"
+)
+
+// reason returns why output should be shown, or "" if it should not.
+func (c conditions) reason(res result) string {
+	switch {
+	case res.timedOut:
+		return ReasonTimeout
+	case !slices.Contains(c.successCodes, res.exitCode):
+		return ReasonExitCode
+	case c.stderr != nil && c.stderr.matched():
+		return ReasonStderr
+	case c.stdout != nil && c.stdout.matched():
+		return ReasonStdoutMatch
+	case c.maxRuntime != 0 && res.runtime > c.maxRuntime:
+		return ReasonMaxRuntime
+	}
+	return ""
+}
+
+// lineMatcher is an io.Writer that records whether any line written to it matches a regex.
+// If invert is true, it records whether any line does not match instead.
+// A nil regex matches every line.
+type lineMatcher struct {
+	re     *regexp.Regexp
+	invert bool
+
+	partial []byte
+	found   bool
+}
+
+func (m *lineMatcher) Write(p []byte) (int, error) {
+	if m.found {
+		return len(p), nil
+	}
+
+	m.partial = append(m.partial, p...)
+	for {
+		i := bytes.IndexByte(m.partial, '\n')
+		if i == -1 {
+			break
+		}
+		m.match(m.partial[:i])
+		m.partial = m.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (m *lineMatcher) match(line []byte) {
+	if !m.found {
+		m.found = m.re == nil || m.re.Match(line) != m.invert
+	}
+}
+
+// matched returns whether a line matched, including an incomplete last line.
+func (m *lineMatcher) matched() bool {
+	if len(m.partial) != 0 {
+		m.match(m.partial)
+		m.partial = nil
+	}
+	return m.found
+}
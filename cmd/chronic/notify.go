@@ -0,0 +1,124 @@
+package chronic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gabe565.com/moreutils/internal/execbuf"
+)
+
+const (
+	NotifyFile   = "file"
+	NotifyAppend = "append"
+	NotifyUnix   = "unix"
+)
+
+// report describes a command whose output was shown. It is sent to notification targets as JSON.
+type report struct {
+	Command  []string  `json:"command"`
+	Hostname string    `json:"hostname"`
+	Reason   string    `json:"reason"`
+	ExitCode int       `json:"exit_code"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration_seconds"`
+	Stdout   string    `json:"stdout"`
+	Stderr   string    `json:"stderr"`
+	// StdoutTruncated and StderrTruncated are set if only the tail of the output is included.
+	StdoutTruncated bool `json:"stdout_truncated"`
+	StderrTruncated bool `json:"stderr_truncated"`
+}
+
+// maxReportOutput is the number of bytes of each stream included in a report.
+const maxReportOutput = 1 << 20
+
+// reportOutput returns up to the last maxReportOutput bytes written to a source, and whether older output was cut.
+// Output is read from the buffer one write at a time, so spilled output is not read into memory in full.
+func reportOutput(buf *execbuf.Buffer, source io.Writer) (string, bool, error) {
+	size := buf.Len(source)
+	skip := size - maxReportOutput
+
+	var b strings.Builder
+	b.Grow(int(min(size, maxReportOutput)))
+	for rec, err := range buf.All(source) {
+		if err != nil {
+			return "", false, err
+		}
+		data := rec.Data
+		if skip > 0 {
+			n := min(skip, int64(len(data)))
+			data, skip = data[n:], skip-n
+		}
+		b.Write(data)
+	}
+	return b.String(), size > maxReportOutput, nil
+}
+
+// notifier sends an encoded report.
+type notifier func(ctx context.Context, data []byte) error
+
+// parseNotifier parses a notification target. Targets in the form "scheme:address" are written to directly.
+// Anything else is run with "sh -c", with the report on stdin and its output sent to stdout and stderr.
+func parseNotifier(arg string, stdout, stderr io.Writer) notifier {
+	if scheme, addr, ok := strings.Cut(arg, ":"); ok && addr != "" {
+		switch scheme {
+		case NotifyFile:
+			return func(_ context.Context, data []byte) error {
+				return os.WriteFile(addr, data, 0o600)
+			}
+		case NotifyAppend:
+			return func(_ context.Context, data []byte) error {
+				f, err := os.OpenFile(addr, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+				if err != nil {
+					return err
+				}
+				_, err = f.Write(data)
+				return errors.Join(err, f.Close())
+			}
+		case NotifyUnix:
+			return func(ctx context.Context, data []byte) error {
+				var dialer net.Dialer
+				conn, err := dialer.DialContext(ctx, scheme, addr)
+				if err != nil {
+					return err
+				}
+				_, err = conn.Write(data)
+				return errors.Join(err, conn.Close())
+			}
+		}
+	}
+
+	return func(ctx context.Context, data []byte) error {
+		e := exec.CommandContext(ctx, "sh", "-c", arg)
+		e.Stdin = bytes.NewReader(data)
+		e.Stdout = stdout
+		e.Stderr = stderr
+		return e.Run()
+	}
+}
+
+// notify sends a report to every target.
+func notify(ctx context.Context, targets []string, notifiers []notifier, r report) error {
+	r.Hostname, _ = os.Hostname()
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	var errs []error
+	for i, n := range notifiers {
+		if err := n(ctx, data); err != nil {
+			errs = append(errs, fmt.Errorf("notify %q: %w", targets[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package chronic
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+
+	"gabe565.com/utils/termx"
+)
+
+// forwardSignals are forwarded to the command. SIGTSTP and SIGCONT carry job control to a command in its own process group.
+var forwardSignals = []os.Signal{
+	syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTSTP, syscall.SIGCONT,
+}
+
+// setProcessGroup runs the command in a new process group, so that signals reach every process it starts.
+// If stdin is a terminal, the command is left in the foreground process group so that it can still read from it.
+// It reports whether a new process group is created.
+func setProcessGroup(e *exec.Cmd) bool {
+	if termx.IsTerminal(e.Stdin) {
+		return false
+	}
+	e.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return true
+}
+
+// signalGroup sends a signal to a process's group, or only to the process if it does not lead a group.
+func signalGroup(p *os.Process, sig os.Signal, group bool) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok || !group {
+		return p.Signal(sig)
+	}
+	return syscall.Kill(-p.Pid, s)
+}
+
+// keyboardSignals are sent by the terminal to its whole foreground process group.
+var keyboardSignals = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP}
+
+// forwardSignal sends a received signal to the command. If the command shares chronic's process group,
+// keyboard signals have already reached it and are not sent again.
+// Catching SIGTSTP keeps chronic from stopping, so it stops itself once the command has been stopped.
+func forwardSignal(p *os.Process, sig os.Signal, group bool) error {
+	var err error
+	if group || !slices.Contains(keyboardSignals, sig) {
+		err = signalGroup(p, sig, group)
+	}
+	if sig == syscall.SIGTSTP {
+		err = errors.Join(err, syscall.Kill(os.Getpid(), syscall.SIGSTOP))
+	}
+	return err
+}
+
+// terminateSignal is sent when the command times out.
+const terminateSignal = syscall.SIGTERM
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package chronic
+
+import (
+	"os"
+	"os/exec"
+)
+
+// forwardSignals are forwarded to the command.
+var forwardSignals = []os.Signal{os.Interrupt}
+
+// setProcessGroup is a no-op, since process groups are unsupported.
+func setProcessGroup(*exec.Cmd) bool { return false }
+
+// signalGroup sends a signal to a process.
+func signalGroup(p *os.Process, sig os.Signal, _ bool) error {
+	return p.Signal(sig)
+}
+
+// forwardSignal sends a received signal to the command.
+func forwardSignal(p *os.Process, sig os.Signal, group bool) error {
+	return signalGroup(p, sig, group)
+}
+
+// terminateSignal is sent when the command times out.
+var terminateSignal = os.Kill
@@ -0,0 +1,113 @@
+package chronic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"gabe565.com/moreutils/internal/execbuf"
+)
+
+//go:generate go tool enumer -type replayFormat -trimprefix replay -transform lower -output replay_string.go
+
+type replayFormat uint8
+
+const (
+	replayRelative replayFormat = iota
+	replayAbsolute
+)
+
+var ErrInvalidReplay = errors.New("invalid replay format")
+
+// replayer prints merged output with a timestamp and stream tag on each line.
+type replayer struct {
+	w      io.Writer
+	stdout io.Writer
+	format replayFormat
+	start  time.Time
+}
+
+// pendingLine is an incomplete line from a single stream.
+type pendingLine struct {
+	ts     time.Time
+	source io.Writer
+	data   []byte
+}
+
+// replay prints every line in the order it was completed, stamped with the time it was started.
+func (r replayer) replay(buf *execbuf.Buffer) error {
+	pending := make(map[io.Writer]*pendingLine, 2)
+	for rec, err := range buf.All() {
+		if err != nil {
+			return err
+		}
+
+		p, ok := pending[rec.Source]
+		if !ok {
+			p = &pendingLine{source: rec.Source}
+			pending[rec.Source] = p
+		}
+
+		data := rec.Data
+		for len(data) != 0 {
+			if len(p.data) == 0 {
+				p.ts = rec.Time
+			}
+			line, rest, found := cutLine(data)
+			p.data = append(p.data, line...)
+			data = rest
+			if !found {
+				break
+			}
+			if err := r.printLine(p); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Print incomplete last lines
+	partial := make([]*pendingLine, 0, len(pending))
+	for _, p := range pending {
+		if len(p.data) != 0 {
+			p.data = append(p.data, '\n')
+			partial = append(partial, p)
+		}
+	}
+	slices.SortFunc(partial, func(a, b *pendingLine) int {
+		return a.ts.Compare(b.ts)
+	})
+	for _, p := range partial {
+		if err := r.printLine(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cutLine splits data after the first newline.
+func cutLine(data []byte) ([]byte, []byte, bool) {
+	if i := bytes.IndexByte(data, '\n'); i != -1 {
+		return data[:i+1], data[i+1:], true
+	}
+	return data, nil, false
+}
+
+func (r replayer) printLine(p *pendingLine) error {
+	tag := "err"
+	if p.source == r.stdout {
+		tag = "out"
+	}
+	_, err := fmt.Fprintf(r.w, "%s %s | %s", r.timestamp(p.ts), tag, p.data)
+	p.data = p.data[:0]
+	return err
+}
+
+func (r replayer) timestamp(ts time.Time) string {
+	if r.format == replayAbsolute {
+		return ts.Format("2006-01-02T15:04:05.000000Z07:00")
+	}
+	return fmt.Sprintf("+%.6fs", max(ts.Sub(r.start), 0).Seconds())
+}
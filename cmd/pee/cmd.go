@@ -2,9 +2,13 @@ package pee
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"log/slog"
 	"os/exec"
 	"os/signal"
+	"slices"
+	"strings"
 	"sync"
 	"syscall"
 
@@ -22,12 +26,37 @@ const (
 	FlagNoIgnoreSigpipe     = "no-ignore-sigpipe"
 	FlagIgnoreWriteErrors   = "ignore-write-errors"
 	FlagNoIgnoreWriteErrors = "no-ignore-write-errors"
+	FlagBuffer              = "buffer"
+	FlagPrefix              = "prefix"
+	FlagPolicy              = "policy"
+	FlagQueueSize           = "queue-size"
+	FlagStats               = "stats"
+	FlagArgv                = "argv"
+	FlagExit                = "exit"
 )
 
 func New(opts ...cobrax.Option) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     Name + " command...",
-		Short:   "Tee standard input to pipes",
+		Use:   Name + " command...",
+		Short: "Tee standard input to pipes",
+		Long: `Tee standard input to pipes.
+
+Each command is run with "sh -c". With --argv, commands are run directly,
+and their arguments are separated by "--":
+  pee --argv -- wc -l -- sha256sum
+
+Targets in the form "scheme:address" are written to directly instead of being run:
+  - file:PATH writes to a file, replacing its contents
+  - append:PATH appends to a file
+  - gzip:PATH writes a gzip-compressed file
+  - unix:PATH connects to a Unix socket
+  - tcp:HOST:PORT connects to a TCP address
+
+The exit status is chosen by --exit:
+  - all: the first failed command in argument order, and every error is reported
+  - first: the first command to fail
+  - max: the highest exit status
+  - bitmask: bit N is set if command N failed, counting from 0 (at most 8 commands)`,
 		Args:    cobra.MinimumNArgs(1),
 		RunE:    run,
 		GroupID: cmdutil.Applet,
@@ -43,6 +72,23 @@ func New(opts ...cobrax.Option) *cobra.Command {
 	if err := cmd.Flags().MarkHidden(FlagIgnoreWriteErrors); err != nil {
 		panic(err)
 	}
+	cmd.Flags().BoolP(FlagBuffer, "b", false, "Buffer each command's output and print it in argument order once all commands exit")
+	cmd.Flags().StringP(FlagPrefix, "p", prefixNone.String(), "Prefix each output line with the command's index or text (one of "+strings.Join(prefixModeStrings(), ", ")+")")
+	cmd.Flags().Lookup(FlagPrefix).NoOptDefVal = prefixIndex.String()
+	must.Must(cmd.RegisterFlagCompletionFunc(FlagPrefix,
+		cobra.FixedCompletions(prefixModeStrings(), cobra.ShellCompDirectiveNoFileComp),
+	))
+	cmd.Flags().String(FlagPolicy, policyBlock.String(), "What to do when a command's input queue is full while another command waits for input (one of "+strings.Join(queuePolicyStrings(), ", ")+")")
+	must.Must(cmd.RegisterFlagCompletionFunc(FlagPolicy,
+		cobra.FixedCompletions(queuePolicyStrings(), cobra.ShellCompDirectiveNoFileComp),
+	))
+	cmd.Flags().Int(FlagQueueSize, 1<<20, "Maximum number of bytes queued for each command")
+	cmd.Flags().Bool(FlagStats, false, "Print the number of bytes delivered to and dropped for each command to stderr")
+	cmd.Flags().Bool(FlagArgv, false, `Run commands without a shell, separating them with "--"`)
+	cmd.Flags().String(FlagExit, exitAll.String(), "How the exit status is chosen (one of "+strings.Join(exitPolicyStrings(), ", ")+")")
+	must.Must(cmd.RegisterFlagCompletionFunc(FlagExit,
+		cobra.FixedCompletions(exitPolicyStrings(), cobra.ShellCompDirectiveNoFileComp),
+	))
 
 	for _, opt := range opts {
 		opt(cmd)
@@ -60,65 +106,168 @@ func run(cmd *cobra.Command, args []string) error {
 	ignoreWriteErrs := must.Must2(cmd.Flags().GetBool(FlagIgnoreWriteErrors)) &&
 		!must.Must2(cmd.Flags().GetBool(FlagNoIgnoreWriteErrors))
 
-	cmds := make([]*exec.Cmd, 0, len(args))
-	pipes := make([]io.Writer, 0, len(args))
-	var errs []error
-	for _, arg := range args {
-		e := exec.CommandContext(cmd.Context(), "sh", "-c", arg)
-		e.Stdout = cmd.OutOrStdout()
-		e.Stderr = cmd.ErrOrStderr()
+	prefix := must.Must2(cmd.Flags().GetString(FlagPrefix))
+	prefixBy, err := prefixModeString(prefix)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidPrefix, prefix)
+	}
+	outOpts := outputOptions{
+		buffer: must.Must2(cmd.Flags().GetBool(FlagBuffer)),
+		prefix: prefixBy,
+		mu:     &sync.Mutex{},
+	}
+
+	policyName := must.Must2(cmd.Flags().GetString(FlagPolicy))
+	policy, err := queuePolicyString(policyName)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidPolicy, policyName)
+	}
+	queueSize := must.Must2(cmd.Flags().GetInt(FlagQueueSize))
+
+	exitName := must.Must2(cmd.Flags().GetString(FlagExit))
+	exitBy, err := exitPolicyString(exitName)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidExit, exitName)
+	}
+
+	commands, err := parseCommands(args, must.Must2(cmd.Flags().GetBool(FlagArgv)))
+	if err != nil {
+		return err
+	}
+	if exitBy == exitBitmask && len(commands) > 8 {
+		return ErrTooManyCommands
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make([]result, 0, len(commands))
+	outputs := make([]*output, 0, len(commands))
+	sinks := make([]*sink, 0, len(commands))
+	group := newSinkGroup(policy, queueSize)
+	for i, c := range commands {
+		if c.open != nil {
+			w, err := c.open(cmd.Context())
+			if err != nil {
+				mu.Lock()
+				results = append(results, result{index: i, err: err, code: 1})
+				mu.Unlock()
+				w = errWriteCloser{err: err}
+			}
+			sinks = append(sinks, group.add(w))
+			continue
+		}
+
+		e := exec.CommandContext(cmd.Context(), c.argv[0], c.argv[1:]...)
+		out := newOutput(cmd.OutOrStdout(), cmd.ErrOrStderr(), i, c.name, outOpts)
+		outputs = append(outputs, out)
+		e.Stdout = out.stdout
+		e.Stderr = out.stderr
 		stdin, err := e.StdinPipe()
 		if err != nil {
 			return err
 		}
+		sinks = append(sinks, group.add(stdin))
 
 		if err := e.Start(); err != nil {
-			errs = append(errs, err)
+			// Like a shell, commands which cannot be started exit with 127
+			mu.Lock()
+			results = append(results, result{index: i, err: err, code: 127})
+			mu.Unlock()
+			continue
 		}
 
-		cmds = append(cmds, e)
-		if ignoreWriteErrs {
-			pipes = append(pipes, util.NewSuppressErrorWriter(stdin))
-		} else {
-			pipes = append(pipes, stdin)
+		wg.Go(func() {
+			err := e.Wait()
+			mu.Lock()
+			results = append(results, result{index: i, err: err, code: exitCode(err)})
+			mu.Unlock()
+		})
+	}
+
+	var errs []error
+	errs = append(errs, feed(cmd.InOrStdin(), sinks, ignoreWriteErrs))
+	wg.Wait()
+
+	for i, c := range commands {
+		if c.open == nil || slices.ContainsFunc(results, func(r result) bool { return r.index == i }) {
+			continue
 		}
+		// Targets fail on write errors, but not when disconnected by the queue policy
+		r := result{index: i}
+		if err := sinks[i].err; err != nil && !errors.Is(err, ErrDisconnected) {
+			r.err, r.code = fmt.Errorf("%s: %w", c.name, err), 1
+		}
+		results = append(results, r)
 	}
 
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-	wg.Go(func() {
-		// Wait for all commands to exit
-		for _, e := range cmds {
-			if err := e.Wait(); err != nil {
-				mu.Lock()
-				errs = append(errs, err)
-				mu.Unlock()
-			}
+	for _, out := range outputs {
+		errs = append(errs, out.flush())
+	}
+
+	stats := must.Must2(cmd.Flags().GetBool(FlagStats))
+	for i, s := range sinks {
+		switch {
+		case stats:
+			errs = append(errs, s.printStats(cmd.ErrOrStderr(), commands[i].name))
+		case s.dropped != 0:
+			slog.Warn("Dropped input for slow command", "command", commands[i].name, "bytes", s.dropped)
 		}
+	}
 
-		// Close pipes
-		for _, pipe := range pipes {
-			if closer, ok := pipe.(io.Closer); ok {
-				_ = closer.Close()
+	if exitBy != exitAll {
+		// Errors which are not exit statuses would be hidden by the exit code
+		for _, r := range results {
+			if _, ok := errors.AsType[*exec.ExitError](r.err); !ok && r.err != nil {
+				cmd.PrintErrln(cmd.ErrPrefix(), r.err)
 			}
 		}
-	})
-
-	if _, err := io.Copy(io.MultiWriter(pipes...), cmd.InOrStdin()); err != nil {
-		mu.Lock()
-		if ignoreWriteErrs {
-			errs = append(errs, util.NewExitCodeError(1))
-		} else {
-			errs = append(errs, err)
-		}
-		mu.Unlock()
 	}
-	for _, pipe := range pipes {
-		if closer, ok := pipe.(io.Closer); ok {
-			_ = closer.Close()
-		}
+	return errors.Join(append([]error{exitError(exitBy, results)}, errs...)...)
+}
+
+// feed copies r to the sinks, then waits for every sink to finish writing.
+func feed(r io.Reader, sinks []*sink, ignoreWriteErrs bool) error {
+	var wg sync.WaitGroup
+	for _, s := range sinks {
+		wg.Go(s.run)
+	}
+
+	err := fanOut(r, sinks, !ignoreWriteErrs)
+	if err != nil && ignoreWriteErrs {
+		err = util.NewExitCodeError(1)
 	}
 
+	for _, s := range sinks {
+		s.close()
+	}
 	wg.Wait()
-	return errors.Join(errs...)
+	return err
+}
+
+// fanOut copies r to every sink. It stops early once every sink has stopped,
+// or once any sink has stopped if failFast is true.
+func fanOut(r io.Reader, sinks []*sink, failFast bool) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n != 0 {
+			var active int
+			for _, s := range sinks {
+				if s.push(buf[:n]) {
+					active++
+				} else if failFast && !errors.Is(s.err, ErrDisconnected) {
+					return s.err
+				}
+			}
+			if active == 0 {
+				return io.ErrClosedPipe
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
 }
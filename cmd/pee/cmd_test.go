@@ -1,11 +1,19 @@
 package pee
 
 import (
+	"compress/gzip"
+	"errors"
 	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"gabe565.com/moreutils/internal/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -36,6 +44,48 @@ func TestPee(t *testing.T) {
 			"test\nd8e8fca2dc0f896fd7cb4cb0031ba249  -\n",
 			require.NoError,
 		},
+		{
+			"buffer",
+			[]string{"--buffer", "cat; sleep 0.1; echo done", "md5sum"},
+			"test\n",
+			"test\ndone\nd8e8fca2dc0f896fd7cb4cb0031ba249  -\n",
+			require.NoError,
+		},
+		{
+			"prefix index",
+			[]string{"--buffer", "--prefix", "cat", "md5sum"},
+			"test\n",
+			"[1] test\n[2] d8e8fca2dc0f896fd7cb4cb0031ba249  -\n",
+			require.NoError,
+		},
+		{
+			"prefix command",
+			[]string{"--buffer", "--prefix=command", "cat", "printf partial"},
+			"a\nb\n",
+			"[cat] a\n[cat] b\n[printf partial] partial",
+			require.NoError,
+		},
+		{
+			"argv",
+			[]string{"--argv", "--buffer", "--", "cat", "--", "printf", "%s\n", "two words"},
+			"test\n",
+			"test\ntwo words\n",
+			require.NoError,
+		},
+		{
+			"argv empty command",
+			[]string{"--argv", "--", "cat", "--"},
+			"",
+			"",
+			require.Error,
+		},
+		{
+			"invalid prefix",
+			[]string{"--prefix=invalid", "cat"},
+			"",
+			"",
+			require.Error,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -49,3 +99,281 @@ func TestPee(t *testing.T) {
 		})
 	}
 }
+
+func TestPeeExit(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"first", []string{"--exit=first", "sleep 0.1; exit 3", "exit 5", "true"}, 5},
+		{"max", []string{"--exit=max", "exit 3", "exit 5", "true"}, 5},
+		{"bitmask", []string{"--exit=bitmask", "exit 3", "true", "exit 5"}, 0b101},
+		{"success", []string{"--exit=max", "true", "true"}, 0},
+		{"not found", []string{"--exit=max", "--argv", "--", "true", "--", "/nonexistent"}, 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := New()
+			cmd.SetArgs(tt.args)
+			cmd.SetIn(strings.NewReader(""))
+			cmd.SetErr(io.Discard)
+			err := cmd.Execute()
+			if tt.want == 0 {
+				require.NoError(t, err)
+				return
+			}
+			exitErr, ok := errors.AsType[*util.ExitCodeError](err)
+			require.True(t, ok)
+			assert.Equal(t, tt.want, exitErr.ExitCode())
+		})
+	}
+
+	t.Run("too many commands", func(t *testing.T) {
+		cmd := New()
+		cmd.SetArgs(append([]string{"--exit=bitmask"}, slices.Repeat([]string{"true"}, 9)...))
+		require.ErrorIs(t, cmd.Execute(), ErrTooManyCommands)
+	})
+}
+
+func TestPeeTargets(t *testing.T) {
+	temp := t.TempDir()
+	file := filepath.Join(temp, "file.log")
+	appendFile := filepath.Join(temp, "append.log")
+	require.NoError(t, os.WriteFile(appendFile, []byte("previous\n"), 0o666))
+	gzipFile := filepath.Join(temp, "file.gz")
+
+	unixListener, err := (&net.ListenConfig{}).Listen(t.Context(), "unix", filepath.Join(temp, "pee.sock"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = unixListener.Close() })
+	tcpListener, err := (&net.ListenConfig{}).Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = tcpListener.Close() })
+
+	accept := func(l net.Listener) <-chan string {
+		ch := make(chan string, 1)
+		go func() {
+			defer close(ch)
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			b, _ := io.ReadAll(conn)
+			_ = conn.Close()
+			ch <- string(b)
+		}()
+		return ch
+	}
+	unixCh, tcpCh := accept(unixListener), accept(tcpListener)
+
+	cmd := New()
+	cmd.SetArgs([]string{
+		"cat",
+		"file:" + file,
+		"append:" + appendFile,
+		"gzip:" + gzipFile,
+		"unix:" + unixListener.Addr().String(),
+		"tcp:" + tcpListener.Addr().String(),
+	})
+	cmd.SetIn(strings.NewReader("test\n"))
+	var stdout strings.Builder
+	cmd.SetOut(&lockedWriter{w: &stdout})
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "test\n", stdout.String())
+
+	b, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "test\n", string(b))
+
+	b, err = os.ReadFile(appendFile)
+	require.NoError(t, err)
+	assert.Equal(t, "previous\ntest\n", string(b))
+
+	f, err := os.Open(gzipFile)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+	gzr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err = io.ReadAll(gzr)
+	require.NoError(t, err)
+	assert.Equal(t, "test\n", string(b))
+
+	assert.Equal(t, "test\n", <-unixCh)
+	assert.Equal(t, "test\n", <-tcpCh)
+
+	t.Run("open error", func(t *testing.T) {
+		cmd := New()
+		cmd.SetArgs([]string{"--exit=bitmask", "cat >/dev/null", "file:" + filepath.Join(temp, "missing", "file")})
+		cmd.SetIn(strings.NewReader("test\n"))
+		cmd.SetErr(io.Discard)
+		exitErr, ok := errors.AsType[*util.ExitCodeError](cmd.Execute())
+		require.True(t, ok)
+		assert.Equal(t, 0b10, exitErr.ExitCode())
+	})
+
+	t.Run("open error after command exits", func(t *testing.T) {
+		cmd := New()
+		cmd.SetArgs([]string{"--exit=bitmask", "true", "file:" + filepath.Join(temp, "missing", "file")})
+		cmd.SetIn(strings.NewReader("test\n"))
+		cmd.SetErr(io.Discard)
+		exitErr, ok := errors.AsType[*util.ExitCodeError](cmd.Execute())
+		require.True(t, ok)
+		assert.Equal(t, 0b10, exitErr.ExitCode())
+	})
+}
+
+func TestPeeStats(t *testing.T) {
+	cmd := New()
+	cmd.SetArgs([]string{"--stats", "cat >/dev/null"})
+	cmd.SetIn(strings.NewReader("test\n"))
+	var stderr strings.Builder
+	cmd.SetErr(&stderr)
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "cat >/dev/null: 5 bytes delivered, 0 bytes dropped\n", stderr.String())
+}
+
+func TestSink(t *testing.T) {
+	t.Run("block", func(t *testing.T) {
+		r, w := io.Pipe()
+		s := newSinkGroup(policyBlock, 4).add(w)
+		require.True(t, s.push([]byte("ab")))
+		require.True(t, s.push([]byte("cd")))
+
+		pushed := make(chan bool)
+		go func() { pushed <- s.push([]byte("ef")) }()
+		select {
+		case <-pushed:
+			t.Fatal("push did not block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		go s.run()
+		buf := make([]byte, 2)
+		_, err := io.ReadFull(r, buf)
+		require.NoError(t, err)
+		assert.True(t, <-pushed)
+
+		s.close()
+		rest, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "abcdef", string(buf)+string(rest))
+		assert.Equal(t, int64(6), s.delivered)
+		assert.Zero(t, s.dropped)
+	})
+
+	t.Run("reader exited", func(t *testing.T) {
+		r, w := io.Pipe()
+		require.NoError(t, r.Close())
+		s := newSinkGroup(policyBlock, 4).add(w)
+		require.True(t, s.push([]byte("ab")))
+		s.close()
+
+		s.run()
+		require.ErrorIs(t, s.err, io.ErrClosedPipe)
+		assert.False(t, s.push([]byte("cd")))
+		assert.Zero(t, s.delivered)
+		assert.Zero(t, s.dropped)
+		assert.Equal(t, int64(4), s.undelivered)
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		r, w := io.Pipe()
+		g := newSinkGroup(policyDropOldest, 4)
+		s := g.add(w)
+		// An idle command is waiting for input
+		g.add(nopWriteCloser{io.Discard})
+		require.True(t, s.push([]byte("ab")))
+		require.True(t, s.push([]byte("cd")))
+		require.True(t, s.push([]byte("ef")))
+		s.close()
+
+		go s.run()
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "cdef", string(b))
+		assert.Equal(t, int64(4), s.delivered)
+		assert.Equal(t, int64(2), s.dropped)
+	})
+
+	t.Run("drop oldest waits for fastest", func(t *testing.T) {
+		g := newSinkGroup(policyDropOldest, 4)
+		s := g.add(nopWriteCloser{io.Discard})
+		other := g.add(nopWriteCloser{io.Discard})
+		for _, s := range []*sink{s, other} {
+			require.True(t, s.push([]byte("ab")))
+			require.True(t, s.push([]byte("cd")))
+		}
+
+		// Every queue is full, so nothing is dropped until another command catches up
+		pushed := make(chan bool)
+		go func() { pushed <- s.push([]byte("ef")) }()
+		select {
+		case <-pushed:
+			t.Fatal("push did not block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		other.close()
+		other.run()
+		assert.True(t, <-pushed)
+		assert.Equal(t, int64(2), s.dropped)
+		assert.Zero(t, other.dropped)
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		r, w := io.Pipe()
+		g := newSinkGroup(policyDisconnect, 3)
+		s := g.add(w)
+		g.add(nopWriteCloser{io.Discard})
+		require.True(t, s.push([]byte("ab")))
+		require.False(t, s.push([]byte("cd")))
+		require.False(t, s.push([]byte("ef")))
+		require.ErrorIs(t, s.err, ErrDisconnected)
+		s.close()
+
+		s.run()
+		b, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Empty(t, b)
+		assert.Zero(t, s.delivered)
+		assert.Equal(t, int64(6), s.dropped)
+	})
+
+	t.Run("disconnect pending write", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = r.Close() })
+		g := newSinkGroup(policyDisconnect, 1<<20)
+		s := g.add(w)
+		g.add(nopWriteCloser{io.Discard})
+
+		// Fill the pipe so that the write blocks
+		big := make([]byte, 1<<20)
+		require.True(t, s.push(big))
+		done := make(chan struct{})
+		go func() {
+			s.run()
+			close(done)
+		}()
+		require.Eventually(t, func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return s.size == 0
+		}, time.Second, time.Millisecond)
+		require.True(t, s.push(big))
+
+		require.False(t, s.push(big))
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("pending write was not interrupted")
+		}
+		require.ErrorIs(t, s.err, ErrDisconnected)
+	})
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,140 @@
+package pee
+
+import (
+	"cmp"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"gabe565.com/moreutils/internal/util"
+)
+
+//go:generate go tool enumer -type exitPolicy -trimprefix exit -transform lower -output exit_string.go
+
+type exitPolicy uint8
+
+const (
+	exitAll exitPolicy = iota
+	exitFirst
+	exitMax
+	exitBitmask
+)
+
+var (
+	ErrInvalidExit     = errors.New("invalid exit policy")
+	ErrTooManyCommands = errors.New("the bitmask exit policy supports at most 8 commands")
+	ErrEmptyCommand    = errors.New("empty command")
+)
+
+// command is a single pee target.
+type command struct {
+	argv []string
+	// open is set if the target is a file or socket instead of a command.
+	open opener
+	// name identifies the command in prefixes and stats.
+	name string
+}
+
+// parseCommands converts arguments to commands.
+// If argv is true, arguments are split into commands on "--". Otherwise, each argument is run with "sh -c".
+// Arguments in the form "scheme:address" are opened as file or socket targets.
+func parseCommands(args []string, argv bool) ([]command, error) {
+	if !argv {
+		commands := make([]command, 0, len(args))
+		for _, arg := range args {
+			if open := parseTarget(arg); open != nil {
+				commands = append(commands, command{open: open, name: arg})
+			} else {
+				commands = append(commands, command{argv: []string{"sh", "-c", arg}, name: arg})
+			}
+		}
+		return commands, nil
+	}
+
+	var commands []command
+	for args := range splitSeq(args, "--") {
+		switch {
+		case len(args) == 0:
+			return nil, ErrEmptyCommand
+		case len(args) == 1 && parseTarget(args[0]) != nil:
+			commands = append(commands, command{open: parseTarget(args[0]), name: args[0]})
+		default:
+			commands = append(commands, command{argv: args, name: strings.Join(args, " ")})
+		}
+	}
+	return commands, nil
+}
+
+// splitSeq yields the groups of args separated by sep.
+func splitSeq(args []string, sep string) func(yield func([]string) bool) {
+	return func(yield func([]string) bool) {
+		for {
+			i := slices.Index(args, sep)
+			if i == -1 {
+				yield(args)
+				return
+			}
+			if !yield(args[:i]) {
+				return
+			}
+			args = args[i+1:]
+		}
+	}
+}
+
+// result is the outcome of a single command.
+type result struct {
+	index int
+	err   error
+	code  int
+}
+
+// exitCode returns the exit code for an error returned by exec.Cmd.Wait.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := errors.AsType[*exec.ExitError](err); ok {
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code
+		}
+		return 255
+	}
+	return 1
+}
+
+// exitError computes the final error for an exit policy from results in completion order.
+func exitError(policy exitPolicy, results []result) error {
+	var code int
+	switch policy {
+	case exitFirst:
+		if i := slices.IndexFunc(results, func(r result) bool { return r.err != nil }); i != -1 {
+			code = results[i].code
+		}
+	case exitMax:
+		for _, r := range results {
+			code = max(code, r.code)
+		}
+	case exitBitmask:
+		for _, r := range results {
+			if r.err != nil {
+				code |= 1 << r.index
+			}
+		}
+	default:
+		results = slices.SortedFunc(slices.Values(results), func(a, b result) int {
+			return cmp.Compare(a.index, b.index)
+		})
+		errs := make([]error, 0, len(results))
+		for _, r := range results {
+			errs = append(errs, r.err)
+		}
+		return errors.Join(errs...)
+	}
+
+	if code == 0 {
+		return nil
+	}
+	return util.NewExitCodeError(code)
+}
@@ -0,0 +1,119 @@
+package pee
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+
+	"gabe565.com/moreutils/internal/execbuf"
+)
+
+//go:generate go tool enumer -type prefixMode -trimprefix prefix -transform lower -output prefix_string.go
+
+type prefixMode uint8
+
+const (
+	prefixNone prefixMode = iota
+	prefixIndex
+	prefixCommand
+)
+
+var ErrInvalidPrefix = errors.New("invalid prefix")
+
+// outputOptions configures how a command's output is written.
+type outputOptions struct {
+	// buffer holds output until flush is called.
+	buffer bool
+	// prefix selects the line prefix, if any.
+	prefix prefixMode
+	// mu is shared by every command to keep prefixed lines from interleaving.
+	mu *sync.Mutex
+}
+
+// output holds the stdout and stderr writers for a single command.
+type output struct {
+	stdout, stderr io.Writer
+	buf            *execbuf.Buffer
+	prefixed       []*prefixWriter
+}
+
+func newOutput(stdout, stderr io.Writer, i int, arg string, opts outputOptions) *output {
+	o := &output{stdout: stdout, stderr: stderr}
+
+	if opts.buffer {
+		o.buf = execbuf.New()
+		o.stdout, o.stderr = o.buf.Writer(stdout), o.buf.Writer(stderr)
+	}
+
+	if opts.prefix != prefixNone {
+		prefix := strconv.Itoa(i + 1)
+		if opts.prefix == prefixCommand {
+			prefix = arg
+		}
+		prefix = "[" + prefix + "] "
+
+		stdout := &prefixWriter{w: o.stdout, mu: opts.mu, prefix: []byte(prefix)}
+		stderr := &prefixWriter{w: o.stderr, mu: opts.mu, prefix: []byte(prefix)}
+		o.stdout, o.stderr = stdout, stderr
+		o.prefixed = []*prefixWriter{stdout, stderr}
+	}
+	return o
+}
+
+// flush writes any incomplete lines and buffered output. It must be called after the command exits.
+func (o *output) flush() error {
+	var errs []error
+	for _, w := range o.prefixed {
+		errs = append(errs, w.Close())
+	}
+	if o.buf != nil {
+		errs = append(errs, o.buf.Print(nil), o.buf.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// prefixWriter prefixes each line written to w.
+// Only complete lines are written, so lines from writers sharing mu never interleave.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix []byte
+	line   []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.line = append(p.line, b...)
+	i := bytes.LastIndexByte(p.line, '\n')
+	if i == -1 {
+		return len(b), nil
+	}
+
+	err := p.writeLines(p.line[:i+1])
+	p.line = append(p.line[:0], p.line[i+1:]...)
+	return len(b), err
+}
+
+// Close writes an incomplete final line.
+func (p *prefixWriter) Close() error {
+	if len(p.line) == 0 {
+		return nil
+	}
+	err := p.writeLines(p.line)
+	p.line = p.line[:0]
+	return err
+}
+
+func (p *prefixWriter) writeLines(lines []byte) error {
+	buf := make([]byte, 0, len(lines)+bytes.Count(lines, []byte("\n"))*len(p.prefix)+len(p.prefix))
+	for line := range bytes.Lines(lines) {
+		buf = append(buf, p.prefix...)
+		buf = append(buf, line...)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(buf)
+	return err
+}
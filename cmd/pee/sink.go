@@ -0,0 +1,198 @@
+package pee
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+//go:generate go tool enumer -type queuePolicy -trimprefix policy -transform kebab -output policy_string.go
+
+type queuePolicy uint8
+
+const (
+	policyBlock queuePolicy = iota
+	policyDropOldest
+	policyDisconnect
+)
+
+var (
+	ErrInvalidPolicy = errors.New("invalid policy")
+	ErrDisconnected  = errors.New("disconnected slow command")
+)
+
+// sinkGroup holds the sinks fed from the same input. They share a lock, so that a sink with a full queue
+// can tell whether it is holding up the others.
+type sinkGroup struct {
+	policy queuePolicy
+	limit  int
+
+	mu    sync.Mutex
+	cond  *sync.Cond
+	sinks []*sink
+}
+
+func newSinkGroup(policy queuePolicy, limit int) *sinkGroup {
+	g := &sinkGroup{policy: policy, limit: limit}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// add creates a sink which writes to w.
+func (g *sinkGroup) add(w io.WriteCloser) *sink {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s := &sink{w: w, g: g}
+	g.sinks = append(g.sinks, s)
+	return s
+}
+
+// sink feeds a single command's stdin from a bounded queue, so that one slow command does not stall the rest.
+// When the queue is full and another command is waiting for input, the policy decides whether to wait,
+// drop the oldest queued data, or disconnect the command. Otherwise, the input waits for the fastest command.
+type sink struct {
+	w io.WriteCloser
+	g *sinkGroup
+
+	chunks [][]byte
+	size   int
+	eof    bool
+	// err is set once the sink stops delivering data.
+	err error
+
+	delivered, dropped int64
+	// undelivered counts bytes which could not be written because the command stopped reading.
+	undelivered int64
+}
+
+// deadliner is implemented by writers whose pending writes can be interrupted, like pipes and sockets.
+type deadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// push queues a copy of p. It reports false once the sink has stopped delivering data.
+func (s *sink) push(p []byte) bool {
+	s.g.mu.Lock()
+	defer s.g.mu.Unlock()
+
+	for s.err == nil && len(s.chunks) != 0 && s.size+len(p) > s.g.limit {
+		if s.g.policy == policyBlock || !s.behind() {
+			s.g.cond.Wait()
+			continue
+		}
+
+		switch s.g.policy {
+		case policyDropOldest:
+			s.discard(len(s.chunks[0]))
+			s.size -= len(s.chunks[0])
+			s.chunks = slices.Delete(s.chunks, 0, 1)
+		case policyDisconnect:
+			s.stop(ErrDisconnected)
+			// Interrupt a pending write. The writer is closed by run once it returns.
+			if d, ok := s.w.(deadliner); ok {
+				_ = d.SetWriteDeadline(time.Now())
+			}
+		}
+	}
+
+	if s.err != nil {
+		s.discard(len(p))
+		return false
+	}
+
+	s.chunks = append(s.chunks, slices.Clone(p))
+	s.size += len(p)
+	s.g.cond.Broadcast()
+	return true
+}
+
+// behind reports whether another sink has emptied its queue, so it is waiting on this one. The lock must be held.
+func (s *sink) behind() bool {
+	return slices.ContainsFunc(s.g.sinks, func(other *sink) bool {
+		return other != s && other.err == nil && other.size == 0
+	})
+}
+
+// close signals that no more data will be pushed.
+func (s *sink) close() {
+	s.g.mu.Lock()
+	defer s.g.mu.Unlock()
+	s.eof = true
+	s.g.cond.Broadcast()
+}
+
+// stop discards queued data and records why the sink stopped. The lock must be held.
+func (s *sink) stop(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	s.discard(s.size)
+	s.chunks, s.size = nil, 0
+	s.g.cond.Broadcast()
+}
+
+// discard counts bytes which will not be delivered. The lock must be held.
+// Bytes are only dropped by the policy; after a write error they are undelivered instead.
+func (s *sink) discard(n int) {
+	if s.err == nil || errors.Is(s.err, ErrDisconnected) {
+		s.dropped += int64(n)
+	} else {
+		s.undelivered += int64(n)
+	}
+}
+
+// run writes queued data until the sink is closed or stopped, then closes the writer.
+func (s *sink) run() {
+	defer func() {
+		err := s.w.Close()
+		s.g.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.g.mu.Unlock()
+	}()
+
+	for {
+		s.g.mu.Lock()
+		for s.err == nil && len(s.chunks) == 0 && !s.eof {
+			s.g.cond.Wait()
+		}
+		if s.err != nil || len(s.chunks) == 0 {
+			s.g.mu.Unlock()
+			return
+		}
+		chunk := s.chunks[0]
+		s.chunks = slices.Delete(s.chunks, 0, 1)
+		s.size -= len(chunk)
+		s.g.cond.Broadcast()
+		s.g.mu.Unlock()
+
+		n, err := s.w.Write(chunk)
+
+		s.g.mu.Lock()
+		s.delivered += int64(n)
+		if err != nil {
+			s.stop(err)
+			s.discard(len(chunk) - n)
+		}
+		s.g.mu.Unlock()
+	}
+}
+
+// printStats writes the number of bytes delivered and dropped, including bytes the command did not read.
+func (s *sink) printStats(w io.Writer, name string) error {
+	s.g.mu.Lock()
+	defer s.g.mu.Unlock()
+
+	_, err := fmt.Fprintf(w, "%s: %d bytes delivered, %d bytes dropped", name, s.delivered, s.dropped+s.undelivered)
+	if err == nil && errors.Is(s.err, ErrDisconnected) {
+		_, err = io.WriteString(w, " (disconnected)")
+	}
+	if err == nil {
+		_, err = io.WriteString(w, "\n")
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package pee
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	TargetFile   = "file"
+	TargetAppend = "append"
+	TargetGzip   = "gzip"
+	TargetUnix   = "unix"
+	TargetTCP    = "tcp"
+)
+
+// opener opens a target's writer.
+type opener func(ctx context.Context) (io.WriteCloser, error)
+
+// parseTarget parses a "scheme:address" target. It returns nil if arg is not a target.
+func parseTarget(arg string) opener {
+	scheme, addr, ok := strings.Cut(arg, ":")
+	if !ok || addr == "" {
+		return nil
+	}
+
+	switch scheme {
+	case TargetFile:
+		return openFile(addr, os.O_TRUNC)
+	case TargetAppend:
+		return openFile(addr, os.O_APPEND)
+	case TargetGzip:
+		return func(ctx context.Context) (io.WriteCloser, error) {
+			f, err := openFile(addr, os.O_TRUNC)(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return &gzipWriteCloser{Writer: gzip.NewWriter(f), f: f}, nil
+		}
+	case TargetUnix, TargetTCP:
+		return func(ctx context.Context) (io.WriteCloser, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, scheme, addr)
+		}
+	}
+	return nil
+}
+
+func openFile(path string, flag int) opener {
+	return func(context.Context) (io.WriteCloser, error) {
+		return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o666)
+	}
+}
+
+// gzipWriteCloser closes the gzip stream, then the underlying file.
+type gzipWriteCloser struct {
+	*gzip.Writer
+	f io.Closer
+}
+
+func (g *gzipWriteCloser) Close() error {
+	return errors.Join(g.Writer.Close(), g.f.Close())
+}
+
+// errWriteCloser fails every write. It stands in for targets which could not be opened.
+type errWriteCloser struct {
+	err error
+}
+
+func (e errWriteCloser) Write([]byte) (int, error) { return 0, e.err }
+
+func (e errWriteCloser) Close() error { return nil }
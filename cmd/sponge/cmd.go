@@ -3,7 +3,6 @@ package sponge
 import (
 	"io"
 	"os"
-	"path/filepath"
 
 	"gabe565.com/moreutils/internal/cmdutil"
 	"gabe565.com/moreutils/internal/util"
@@ -41,34 +40,19 @@ func run(cmd *cobra.Command, args []string) error {
 	cmd.SilenceUsage = true
 
 	var out io.Writer
-	var tmp *os.File
-	var stat os.FileInfo
+	var tmp *util.ReplaceFile
 	if len(args) == 0 {
 		out = cmd.OutOrStdout()
 	} else {
 		var err error
-		stat, err = os.Stat(args[0])
-		if err != nil && !os.IsNotExist(err) {
-			return err
-		}
-
-		tmp, err = os.CreateTemp("", "sponge-*-"+filepath.Base(args[0]))
+		tmp, err = util.CreateReplaceFile(args[0])
 		if err != nil {
 			return err
 		}
 		defer func() {
 			_ = tmp.Close()
-			_ = os.Remove(tmp.Name())
 		}()
 
-		if stat != nil {
-			prevUmask := util.Umask(0)
-			if err := tmp.Chmod(stat.Mode()); err != nil {
-				return err
-			}
-			util.Umask(prevUmask)
-		}
-
 		out = tmp
 	}
 
@@ -95,38 +79,7 @@ func run(cmd *cobra.Command, args []string) error {
 	}
 
 	if tmp != nil {
-		if err := tmp.Close(); err != nil {
-			return err
-		}
-
-		if err := os.Rename(tmp.Name(), args[0]); err != nil {
-			// Atomic copy not possible
-			in, err := os.Open(tmp.Name())
-			if err != nil {
-				return err
-			}
-			defer func() {
-				_ = in.Close()
-			}()
-
-			mode := os.FileMode(0o666)
-			if stat != nil {
-				mode = stat.Mode()
-			}
-
-			out, err := os.OpenFile(args[0], os.O_WRONLY|os.O_TRUNC, mode)
-			if err != nil {
-				return err
-			}
-
-			if _, err := io.Copy(out, in); err != nil {
-				return err
-			}
-
-			if err := out.Close(); err != nil {
-				return err
-			}
-		}
+		return tmp.Commit()
 	}
 	return nil
 }
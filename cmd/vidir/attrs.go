@@ -0,0 +1,241 @@
+package vidir
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMode      = errors.New("invalid mode")
+	ErrInvalidOwner     = errors.New("invalid owner")
+	ErrSymlinkAttrs     = errors.New("cannot change the mode or modification time of a symlink")
+	ErrOwnerUnsupported = errors.New("changing owners is not supported on this platform")
+)
+
+// attrs holds the formatted metadata columns of a long listing.
+type attrs struct {
+	mode  string
+	owner string
+	mtime string
+}
+
+const (
+	attrsFields = 3
+	timeFormat  = time.DateTime
+	noOwner     = "-"
+)
+
+// newAttrs formats the metadata columns for a file.
+func newAttrs(info fs.FileInfo) attrs {
+	a := attrs{
+		mode:  formatMode(info.Mode()),
+		owner: noOwner,
+		mtime: info.ModTime().Local().Format(timeFormat),
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		a.owner = formatOwner(uid, gid)
+	}
+	return a
+}
+
+// parseAttrs parses metadata columns from a long listing line.
+func parseAttrs(fields []string) attrs {
+	return attrs{mode: fields[0], owner: fields[1], mtime: fields[2]}
+}
+
+// String returns the columns as they are written to the listing.
+func (a attrs) String() string {
+	return a.mode + "\t" + a.owner + "\t" + a.mtime
+}
+
+// ops returns the operations required to change a path's metadata from orig to a.
+func (a attrs) ops(path, orig string, origAttrs attrs) ([]op, error) {
+	if a == origAttrs {
+		return nil, nil
+	}
+
+	info, err := os.Lstat(orig)
+	if err != nil {
+		return nil, err
+	}
+	isLink := info.Mode()&fs.ModeSymlink != 0
+
+	var ops []op
+	if a.mode != origAttrs.mode {
+		if isLink {
+			return nil, fmt.Errorf("%q: %w", path, ErrSymlinkAttrs)
+		}
+		mode, err := parseMode(a.mode)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, &chmodOp{path: path, from: info.Mode(), to: mode})
+	}
+
+	if a.owner != origAttrs.owner {
+		uid, gid, ok := fileOwner(info)
+		if !ok {
+			return nil, ErrOwnerUnsupported
+		}
+		toUID, toGID, err := parseOwner(a.owner)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, &chownOp{
+			path: path, owner: a.owner,
+			fromUID: uid, fromGID: gid,
+			toUID: toUID, toGID: toGID,
+		})
+	}
+
+	if a.mtime != origAttrs.mtime {
+		if isLink {
+			return nil, fmt.Errorf("%q: %w", path, ErrSymlinkAttrs)
+		}
+		mtime, err := time.ParseInLocation(timeFormat, a.mtime, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, &chtimesOp{path: path, from: info.ModTime(), to: mtime})
+	}
+
+	return ops, nil
+}
+
+// formatMode formats permission and special bits as an octal string.
+func formatMode(mode fs.FileMode) string {
+	v := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		v |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		v |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		v |= 0o1000
+	}
+	return fmt.Sprintf("%04o", v)
+}
+
+// parseMode parses an octal mode string as formatted by formatMode.
+func parseMode(s string) (fs.FileMode, error) {
+	v, err := strconv.ParseUint(s, 8, 12)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidMode, s)
+	}
+
+	mode := fs.FileMode(v).Perm()
+	if v&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if v&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if v&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode, nil
+}
+
+// formatOwner formats a uid and gid as "user:group", falling back to numeric IDs.
+func formatOwner(uid, gid int) string {
+	owner := strconv.Itoa(uid)
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+	group := strconv.Itoa(gid)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return owner + ":" + group
+}
+
+// parseOwner parses a "user:group" string. Users and groups may be names or numeric IDs.
+func parseOwner(s string) (int, int, error) {
+	owner, group, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %q", ErrInvalidOwner, s)
+	}
+
+	uid, err := strconv.Atoi(owner)
+	if err != nil {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: %w", ErrInvalidOwner, err)
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("%w: %w", ErrInvalidOwner, err)
+		}
+	}
+
+	gid, err := strconv.Atoi(group)
+	if err != nil {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: %w", ErrInvalidOwner, err)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, fmt.Errorf("%w: %w", ErrInvalidOwner, err)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// chmodOp changes the mode of a path.
+type chmodOp struct {
+	path     string
+	from, to fs.FileMode
+}
+
+func (o *chmodOp) String() string {
+	return fmt.Sprintf("chmod %q %s => %s", o.path, formatMode(o.from), formatMode(o.to))
+}
+
+func (o *chmodOp) marker() byte { return '~' }
+
+func (o *chmodOp) apply() error { return os.Chmod(o.path, o.to) }
+
+func (o *chmodOp) undo() error { return os.Chmod(o.path, o.from) }
+
+// chownOp changes the owner of a path.
+type chownOp struct {
+	path             string
+	owner            string
+	fromUID, fromGID int
+	toUID, toGID     int
+}
+
+func (o *chownOp) String() string {
+	return fmt.Sprintf("chown %q %s => %s", o.path, formatOwner(o.fromUID, o.fromGID), o.owner)
+}
+
+func (o *chownOp) marker() byte { return '~' }
+
+func (o *chownOp) apply() error { return os.Lchown(o.path, o.toUID, o.toGID) }
+
+func (o *chownOp) undo() error { return os.Lchown(o.path, o.fromUID, o.fromGID) }
+
+// chtimesOp changes the modification time of a path. The access time is left unchanged.
+type chtimesOp struct {
+	path     string
+	from, to time.Time
+}
+
+func (o *chtimesOp) String() string {
+	return fmt.Sprintf("touch %q %s => %s",
+		o.path, o.from.Local().Format(timeFormat), o.to.Local().Format(timeFormat),
+	)
+}
+
+func (o *chtimesOp) marker() byte { return '~' }
+
+func (o *chtimesOp) apply() error { return os.Chtimes(o.path, time.Time{}, o.to) }
+
+func (o *chtimesOp) undo() error { return os.Chtimes(o.path, time.Time{}, o.from) }
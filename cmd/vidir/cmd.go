@@ -1,17 +1,10 @@
 package vidir
 
 import (
-	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
-	"io/fs"
-	"math"
 	"os"
-	"path/filepath"
-	"slices"
-	"strconv"
+	"strings"
 
 	"gabe565.com/moreutils/internal/cmdutil"
 	"gabe565.com/moreutils/internal/editor"
@@ -21,21 +14,75 @@ import (
 )
 
 const (
-	Name          = "vidir"
-	FlagVerbose   = "verbose"
-	FlagRecursive = "recursive"
+	Name                = "vidir"
+	FlagVerbose         = "verbose"
+	FlagRecursive       = "recursive"
+	FlagDryRun          = "dry-run"
+	FlagInteractive     = "interactive"
+	FlagRemoveRecursive = "remove-recursive"
+	FlagTrash           = "trash"
+	FlagNull            = "null"
+	FlagLong            = "long"
+	FlagMaxDepth        = "max-depth"
+	FlagAll             = "all"
+	FlagInclude         = "include"
+	FlagExclude         = "exclude"
+	FlagGitignore       = "gitignore"
+	FlagSort            = "sort"
+	FlagGit             = "git"
 )
 
 func New(opts ...cobrax.Option) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     Name + " [file | dir]...",
-		Short:   "Edit a directory in your text editor",
+		Use:   Name + " [file | dir | -]...",
+		Short: "Edit a directory in your text editor",
+		Long: `Edit a directory in your text editor.
+
+If "-" is given, a list of paths is read from stdin.
+Entries found in directories are filtered by --all, --include, --exclude, and --gitignore.
+Entries whose names begin with a dot are hidden unless --all is given.
+
+Each line of the buffer is an index followed by a tab and a path.
+  - Change the path to rename the entry.
+  - Remove the line to delete the entry. Non-empty directories require --remove-recursive or --trash.
+  - Repeat an index on another line to copy the entry.
+  - Add a line without an index to create a file, or a directory if it ends with "/".
+  - Add a line without an index in the form "path -> target" to create a symlink.
+
+With --long, each index is followed by mode, owner, and modification time
+columns before the path. Edit them to change the entry's metadata.
+
+Paths containing tabs, newlines, or leading or trailing whitespace are shown as
+double-quoted strings with Go escape sequences. Any path may be written this way.
+
+Changes are validated before anything is modified. If any operation fails,
+all previous operations are rolled back.
+
+With --git, tracked entries are moved and removed with "git mv" and "git rm" so
+that renames are recorded in the index. Untracked entries are changed directly.`,
 		RunE:    run,
 		GroupID: cmdutil.Applet,
 	}
 
 	cmd.Flags().BoolP(FlagVerbose, "v", false, "Verbosely display the actions taken by the program.")
 	cmd.Flags().BoolP(FlagRecursive, "r", false, "Recurses into subdirectories")
+	cmd.Flags().IntP(FlagMaxDepth, "d", 0, "Recurse into subdirectories up to a depth limit. 0 is unlimited.")
+	cmd.Flags().BoolP(FlagAll, "a", false, "Include entries whose names begin with a dot")
+	cmd.Flags().StringSlice(FlagInclude, nil, "Only list entries with a name or path matching a glob")
+	cmd.Flags().StringSlice(FlagExclude, nil, "Skip entries with a name or path matching a glob")
+	cmd.Flags().Bool(FlagGitignore, false, "Skip entries which are ignored by .gitignore files")
+	cmd.Flags().String(FlagSort, sortName.String(), "Sort order (one of "+strings.Join(sortOrderStrings(), ", ")+")")
+	must.Must(cmd.RegisterFlagCompletionFunc(FlagSort,
+		cobra.FixedCompletions(sortOrderStrings(), cobra.ShellCompDirectiveNoFileComp),
+	))
+	cmd.Flags().BoolP(FlagDryRun, "n", false, "Print the planned changes without applying them")
+	cmd.Flags().BoolP(FlagInteractive, "i", false, "Print the planned changes and prompt before applying them")
+	cmd.MarkFlagsMutuallyExclusive(FlagDryRun, FlagInteractive)
+	cmd.Flags().BoolP(FlagRemoveRecursive, "R", false, "Allow removing non-empty directories")
+	cmd.Flags().BoolP(FlagTrash, "t", false, "Move removed entries to the trash instead of deleting them")
+	cmd.Flags().BoolP(FlagGit, "g", false, `Move and remove tracked entries with "git mv" and "git rm"`)
+	cmd.Flags().BoolP(FlagLong, "l", false, "Add editable mode, owner, and modification time columns to the listing")
+	cmd.Flags().BoolP(FlagNull, "0", false, `Paths read from stdin are separated by NUL instead of newline (e.g. "find -print0")`)
 
 	for _, opt := range opts {
 		opt(cmd)
@@ -43,14 +90,17 @@ func New(opts ...cobrax.Option) *cobra.Command {
 	return cmd
 }
 
-var (
-	ErrInvalidIndex = errors.New("invalid index")
-	ErrFieldCount   = errors.New("invalid field count")
-)
+var ErrAborted = errors.New("aborted")
 
 func run(cmd *cobra.Command, args []string) error {
 	cmd.SilenceUsage = true
 
+	sort := must.Must2(cmd.Flags().GetString(FlagSort))
+	sortBy, err := sortOrderString(sort)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidSort, sort)
+	}
+
 	tmp, err := os.CreateTemp("", "vidir-*.txt")
 	if err != nil {
 		return err
@@ -60,8 +110,26 @@ func run(cmd *cobra.Command, args []string) error {
 		_ = os.Remove(tmp.Name())
 	}()
 
-	recursive := must.Must2(cmd.Flags().GetBool(FlagRecursive))
-	paths, err := createListing(tmp, args, recursive)
+	maxDepth := 1
+	if must.Must2(cmd.Flags().GetBool(FlagRecursive)) {
+		maxDepth = 0
+	}
+	if cmd.Flags().Changed(FlagMaxDepth) {
+		maxDepth = must.Must2(cmd.Flags().GetInt(FlagMaxDepth))
+	}
+
+	long := must.Must2(cmd.Flags().GetBool(FlagLong))
+	l, err := createListing(tmp, args, listOptions{
+		maxDepth:  maxDepth,
+		all:       must.Must2(cmd.Flags().GetBool(FlagAll)),
+		include:   must.Must2(cmd.Flags().GetStringSlice(FlagInclude)),
+		exclude:   must.Must2(cmd.Flags().GetStringSlice(FlagExclude)),
+		gitignore: must.Must2(cmd.Flags().GetBool(FlagGitignore)),
+		sort:      sortBy,
+		long:      long,
+		stdin:     cmd.InOrStdin(),
+		null:      must.Must2(cmd.Flags().GetBool(FlagNull)),
+	})
 	if err != nil {
 		return err
 	}
@@ -80,123 +148,42 @@ func run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	verbose := must.Must2(cmd.Flags().GetBool(FlagVerbose))
-	seen := make([]int, 0, len(paths))
-
-	scanner := bufio.NewScanner(tmp)
-	for scanner.Scan() {
-		parts := bytes.SplitN(bytes.TrimSpace(scanner.Bytes()), []byte("\t"), 2)
-		switch len(parts) {
-		case 0:
-			continue
-		case 1:
-			return fmt.Errorf("%w: %d", ErrFieldCount, len(parts))
-		}
-
-		i, err := strconv.Atoi(string(parts[0]))
-		if err != nil {
-			return err
-		}
-		i--
-		if i < 0 || i > len(paths)-1 {
-			return fmt.Errorf("%w: %d", ErrInvalidIndex, i+1)
-		}
-
-		oldName := paths[i]
-		newName := string(parts[1])
-
-		seen = append(seen, i)
-		if oldName == newName {
-			continue
-		}
-
-		tmpName := newName
-		for i := 0; ; i++ {
-			if _, err := os.Stat(tmpName); err == nil {
-				// New file already exists
-				if i == 0 {
-					tmpName += "~"
-				} else {
-					tmpName = newName + "~" + strconv.Itoa(i)
-				}
-			} else if !os.IsNotExist(err) {
-				return err
-			} else {
-				break
-			}
-		}
-		if tmpName != newName {
-			if err := rename(cmd.OutOrStdout(), newName, tmpName, verbose); err != nil {
-				return err
-			}
-			for k, v := range paths {
-				if newName == v {
-					paths[k] = tmpName
-				}
-			}
-		}
-
-		if err := rename(cmd.OutOrStdout(), oldName, newName, verbose); err != nil {
-			return err
-		}
+	entries, err := parseListing(tmp, len(l.paths), long)
+	if err != nil {
+		return err
 	}
 
-	for i, name := range paths {
-		if !slices.Contains(seen, i) {
-			if err := os.Remove(name); err != nil {
-				return err
-			}
+	planOpts := planOptions{
+		removeRecursive: must.Must2(cmd.Flags().GetBool(FlagRemoveRecursive)),
+		trash:           must.Must2(cmd.Flags().GetBool(FlagTrash)),
+	}
+	if must.Must2(cmd.Flags().GetBool(FlagGit)) {
+		if planOpts.git, err = newGitRepo(cmd.Context()); err != nil {
+			return err
 		}
 	}
 
-	return scanner.Err()
-}
-
-func createListing(w io.Writer, args []string, recursive bool) ([]string, error) {
-	if len(args) == 0 {
-		args = append(args, ".")
+	p, err := newPlan(l, entries, planOpts)
+	if err != nil {
+		return err
 	}
 
-	paths := make([]string, 0, len(args))
-	buf := bufio.NewWriter(w)
-	for _, arg := range args {
-		glob, err := filepath.Glob(arg)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, globPath := range glob {
-			if err := filepath.WalkDir(globPath, func(path string, d fs.DirEntry, err error) error {
-				if err != nil || (path == globPath && d.IsDir()) {
-					return err
-				}
-
-				paths = append(paths, path)
-
-				if !recursive && d.IsDir() {
-					// Do not recurse more than 1 level
-					return filepath.SkipDir
-				}
-				return nil
-			}); err != nil {
-				return nil, err
-			}
+	switch {
+	case len(p) == 0:
+		return nil
+	case must.Must2(cmd.Flags().GetBool(FlagDryRun)):
+		return p.Print(cmd.OutOrStdout())
+	case must.Must2(cmd.Flags().GetBool(FlagInteractive)):
+		if err := p.Print(cmd.OutOrStdout()); err != nil {
+			return err
 		}
-	}
-
-	pad := strconv.FormatInt(int64(math.Log10(float64(len(paths)))+1), 10)
-	for i, path := range paths {
-		if _, err := fmt.Fprintf(buf, "%0"+pad+"d\t%s\n", i+1, path); err != nil {
-			return nil, err
+		if ok, err := confirm(cmd, !disableTTY); err != nil {
+			return err
+		} else if !ok {
+			return ErrAborted
 		}
 	}
 
-	return paths, buf.Flush()
-}
-
-func rename(w io.Writer, oldname, newname string, verbose bool) error {
-	if verbose {
-		_, _ = fmt.Fprintf(w, "%q => %q\n", oldname, newname)
-	}
-	return os.Rename(oldname, newname)
+	verbose := must.Must2(cmd.Flags().GetBool(FlagVerbose))
+	return p.Apply(cmd.OutOrStdout(), verbose)
 }
@@ -1,10 +1,16 @@
 package vidir
 
 import (
+	"io"
+	"io/fs"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"gabe565.com/moreutils/internal/cmdutil"
 	"github.com/stretchr/testify/assert"
@@ -34,6 +40,7 @@ func TestRun(t *testing.T) {
 	tempFile(t, temp, "d")
 
 	// Swap a and b, rename c to newname, remove d
+	t.Setenv("VISUAL", "")
 	t.Setenv("EDITOR", `sh -c 'cat > "$0" <<EOT
 0002	a
 0001	b
@@ -47,10 +54,11 @@ EOT'`)
 	require.NoError(t, cmd.Execute())
 
 	// Check verbose logs
-	assert.Equal(t, `"a" => "a~"
+	assert.Equal(t, `"c" => "newname"
+removed "d"
+"a" => ".vidir-a"
 "b" => "a"
-"a~" => "b"
-"c" => "newname"
+".vidir-a" => "b"
 `, buf.String())
 
 	// Check dir contents
@@ -73,3 +81,531 @@ EOT'`)
 		}
 	}
 }
+
+func TestRunRenames(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		args    []string
+		buffer  string
+		want    map[string]string
+		wantErr require.ErrorAssertionFunc
+	}{
+		{
+			"rotate",
+			[]string{"a", "b", "c"},
+			nil,
+			"1\tb\n2\tc\n3\ta\n",
+			map[string]string{"a": "c", "b": "a", "c": "b"},
+			require.NoError,
+		},
+		{
+			"chain",
+			[]string{"a", "b"},
+			nil,
+			"1\tb\n2\tc\n",
+			map[string]string{"b": "a", "c": "b"},
+			require.NoError,
+		},
+		{
+			"replace removed",
+			[]string{"a", "b"},
+			nil,
+			"1\tb\n",
+			map[string]string{"b": "a"},
+			require.NoError,
+		},
+		{
+			"duplicate destination",
+			[]string{"a", "b"},
+			nil,
+			"1\tc\n2\tc\n",
+			map[string]string{"a": "a", "b": "b"},
+			require.Error,
+		},
+		{
+			"rename directory",
+			[]string{"d/a", "d/b"},
+			[]string{"--recursive"},
+			"1\te\n2\te/a\n3\te/c\n",
+			map[string]string{"e/a": "d/a", "e/c": "d/b"},
+			require.NoError,
+		},
+		{
+			"rename directory keep child",
+			[]string{"d/a"},
+			[]string{"--recursive"},
+			"1\te\n2\td/a\n",
+			map[string]string{"d/a": "d/a", "e/": ""},
+			require.NoError,
+		},
+		{
+			"move into renamed directory",
+			[]string{"a", "d/x"},
+			[]string{"--recursive"},
+			"1\te/a\n2\te\n3\te/x\n",
+			map[string]string{"e/a": "a", "e/x": "d/x"},
+			require.NoError,
+		},
+		{
+			"copy into self",
+			[]string{"d/a"},
+			nil,
+			"1\td\n1\td/sub\n",
+			map[string]string{"d/a": "d/a"},
+			func(t require.TestingT, err error, _ ...any) {
+				require.ErrorIs(t, err, ErrCopyIntoSelf)
+			},
+		},
+		{
+			"move into removed directory",
+			[]string{"a", "d/b"},
+			[]string{"--recursive"},
+			"1\td\n",
+			map[string]string{"d": "a"},
+			require.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp := t.TempDir()
+			t.Chdir(temp)
+
+			for _, name := range tt.files {
+				require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o777))
+				require.NoError(t, os.WriteFile(name, []byte(name), 0o666))
+			}
+
+			buffer := filepath.Join(t.TempDir(), "buffer")
+			require.NoError(t, os.WriteFile(buffer, []byte(tt.buffer), 0o666))
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", "cp "+buffer)
+
+			cmd := New(cmdutil.DisableTTY())
+			cmd.SetOut(io.Discard)
+			cmd.SetArgs(tt.args)
+			tt.wantErr(t, cmd.Execute())
+
+			got := make(map[string]string)
+			require.NoError(t, filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+				switch {
+				case err != nil || path == ".":
+					return err
+				case d.IsDir():
+					if entries, err := os.ReadDir(path); err != nil || len(entries) != 0 {
+						return err
+					}
+					got[path+"/"] = ""
+				default:
+					b, err := os.ReadFile(path)
+					if err != nil {
+						return err
+					}
+					got[path] = string(b)
+				}
+				return nil
+			}))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunRemove(t *testing.T) {
+	temp := t.TempDir()
+	t.Chdir(temp)
+
+	require.NoError(t, os.Mkdir("dir", 0o777))
+	tempFile(t, temp, filepath.Join("dir", "a"))
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c ': > "$0"'`)
+
+	t.Run("not empty", func(t *testing.T) {
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetOut(io.Discard)
+		require.ErrorIs(t, cmd.Execute(), ErrDirNotEmpty)
+		assert.DirExists(t, "dir")
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		dataHome := t.TempDir()
+		t.Setenv("XDG_DATA_HOME", dataHome)
+
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetOut(io.Discard)
+		cmd.SetArgs([]string{"--trash"})
+		require.NoError(t, cmd.Execute())
+		assert.NoDirExists(t, "dir")
+		assert.FileExists(t, filepath.Join(dataHome, "Trash", "files", "dir", "a"))
+		assert.FileExists(t, filepath.Join(dataHome, "Trash", "info", "dir.trashinfo"))
+
+		require.NoError(t, os.Rename(filepath.Join(dataHome, "Trash", "files", "dir"), "dir"))
+	})
+
+	t.Run("recursive", func(t *testing.T) {
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetOut(io.Discard)
+		cmd.SetArgs([]string{"--remove-recursive"})
+		require.NoError(t, cmd.Execute())
+
+		entries, err := os.ReadDir(temp)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
+
+func TestRunGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"default", []string{"--git"}},
+		{"trash", []string{"--git", "--trash"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp := t.TempDir()
+			t.Chdir(temp)
+			t.Setenv("XDG_DATA_HOME", t.TempDir())
+			t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+			t.Setenv("GIT_AUTHOR_NAME", "test")
+			t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+			t.Setenv("GIT_COMMITTER_NAME", "test")
+			t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+			git := func(args ...string) string {
+				out, err := exec.CommandContext(t.Context(), "git", args...).Output()
+				require.NoError(t, err)
+				return string(out)
+			}
+
+			git("init", "-q")
+			require.NoError(t, os.Mkdir("d", 0o777))
+			tempFile(t, temp, "a")
+			tempFile(t, temp, "b")
+			tempFile(t, temp, filepath.Join("d", "x"))
+			git("add", "a", "b", "d")
+			git("commit", "-q", "-m", "init")
+			tempFile(t, temp, "u")
+
+			// Rename a to c, remove b, rename d to e, rename untracked u to v
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", `sh -c 'printf "1\tc\n3\te\n4\tv\n" > "$0"'`)
+
+			cmd := New(cmdutil.DisableTTY())
+			cmd.SetOut(io.Discard)
+			cmd.SetArgs(tt.args)
+			require.NoError(t, cmd.Execute())
+
+			status := strings.Split(strings.TrimSpace(git("status", "--porcelain")), "\n")
+			assert.ElementsMatch(t, []string{
+				"R  a -> c",
+				"D  b",
+				"R  d/x -> e/x",
+				"?? v",
+			}, status)
+			assert.NoFileExists(t, "b")
+		})
+	}
+}
+
+func TestRunListing(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		args  []string
+		want  string
+	}{
+		{"hidden", []string{"a", ".b"}, nil, "1\ta\n"},
+		{"all", []string{"a", ".b"}, []string{"--all"}, "1\t.b\n2\ta\n"},
+		{"exclude", []string{"a", "b.log"}, []string{"--exclude=*.log"}, "1\ta\n"},
+		{
+			"include",
+			[]string{"a.txt", "b.log", "d/c.txt", "d/e.log"},
+			[]string{"--recursive", "--include=*.txt"},
+			"1\ta.txt\n2\td/c.txt\n",
+		},
+		{
+			"gitignore",
+			[]string{"a", "b.log", "build/c", "d/e", "d/f"},
+			[]string{"--recursive", "--gitignore"},
+			"1\ta\n2\td\n3\td/e\n",
+		},
+		{"gitignore dot prefix", []string{"a", "..b.log", "d/e"}, []string{"--all", "--gitignore"}, "1\t.gitignore\n2\ta\n3\td\n"},
+		{"max depth", []string{"a/b/c/d"}, []string{"--max-depth=2"}, "1\ta\n2\ta/b\n"},
+		{
+			"sort name",
+			[]string{"a.txt", "a/c", "b"},
+			[]string{"--recursive", "b", "a.txt", "a"},
+			"1\ta/c\n2\ta.txt\n3\tb\n",
+		},
+		{"sort size", []string{"a", "bbb", "cc"}, []string{"--sort=size"}, "1\tbbb\n2\tcc\n3\ta\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp := t.TempDir()
+			t.Chdir(temp)
+
+			for _, name := range tt.files {
+				require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o777))
+				require.NoError(t, os.WriteFile(name, []byte(filepath.Base(name)), 0o666))
+			}
+			if slices.Contains(tt.args, "--gitignore") {
+				require.NoError(t, os.WriteFile(".gitignore", []byte("*.log\nbuild/\n"), 0o666))
+				require.NoError(t, os.WriteFile(filepath.Join("d", ".gitignore"), []byte("f\n"), 0o666))
+			}
+
+			listing := filepath.Join(t.TempDir(), "listing")
+			t.Setenv("VISUAL", "")
+			t.Setenv("EDITOR", `sh -c 'cp "$0" `+listing+`'`)
+
+			cmd := New(cmdutil.DisableTTY())
+			cmd.SetOut(io.Discard)
+			cmd.SetArgs(tt.args)
+			require.NoError(t, cmd.Execute())
+
+			b, err := os.ReadFile(listing)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestRunCreate(t *testing.T) {
+	temp := t.TempDir()
+	t.Chdir(temp)
+
+	tempFile(t, temp, "a")
+
+	// Keep a, copy a to b, create a file, a directory, and a symlink
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'cat > "$0" <<EOT
+1	a
+1	b
+file
+dir/
+link -> a
+EOT'`)
+
+	cmd := New(cmdutil.DisableTTY())
+	var buf strings.Builder
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"--verbose"})
+	require.NoError(t, cmd.Execute())
+
+	assert.Equal(t, `copied "a" => "b"
+created "file"
+created "dir"
+linked "link" -> "a"
+`, buf.String())
+
+	b, err := os.ReadFile("b")
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(b))
+
+	b, err = os.ReadFile("file")
+	require.NoError(t, err)
+	assert.Empty(t, b)
+
+	stat, err := os.Stat("dir")
+	require.NoError(t, err)
+	assert.True(t, stat.IsDir())
+
+	target, err := os.Readlink("link")
+	require.NoError(t, err)
+	assert.Equal(t, "a", target)
+}
+
+func TestRunDryRun(t *testing.T) {
+	temp := t.TempDir()
+	t.Chdir(temp)
+
+	tempFile(t, temp, "a")
+	tempFile(t, temp, "b")
+
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'cat > "$0" <<EOT
+1	c
+new
+EOT'`)
+
+	cmd := New(cmdutil.DisableTTY())
+	var buf strings.Builder
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"--dry-run"})
+	require.NoError(t, cmd.Execute())
+
+	assert.Equal(t, `~ "a" => "c"
+- removed "b"
++ created "new"
+`, buf.String())
+
+	entries, err := os.ReadDir(temp)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestRunInteractive(t *testing.T) {
+	temp := t.TempDir()
+	t.Chdir(temp)
+
+	tempFile(t, temp, "a")
+
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'echo "1	b" > "$0"'`)
+
+	t.Run("declined", func(t *testing.T) {
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetOut(io.Discard)
+		cmd.SetIn(strings.NewReader("n\n"))
+		cmd.SetArgs([]string{"--interactive"})
+		require.ErrorIs(t, cmd.Execute(), ErrAborted)
+		assert.FileExists(t, "a")
+		assert.NoFileExists(t, "b")
+	})
+
+	t.Run("accepted", func(t *testing.T) {
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetOut(io.Discard)
+		cmd.SetIn(strings.NewReader("y\n"))
+		cmd.SetArgs([]string{"--interactive"})
+		require.NoError(t, cmd.Execute())
+		assert.NoFileExists(t, "a")
+		assert.FileExists(t, "b")
+	})
+}
+
+func TestRunRollback(t *testing.T) {
+	temp := t.TempDir()
+	t.Chdir(temp)
+
+	tempFile(t, temp, "a")
+	tempFile(t, temp, "b")
+	require.NoError(t, os.Mkdir("dir", 0o777))
+
+	// Sockets cannot be copied, so the copy fails after the other operations have been applied
+	l, err := net.Listen("unix", filepath.Join("dir", "sock"))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'cat > "$0" <<EOT
+1	z
+3	dir
+3	dir2
+EOT'`)
+
+	cmd := New(cmdutil.DisableTTY())
+	cmd.SetOut(io.Discard)
+	require.Error(t, cmd.Execute())
+
+	assert.FileExists(t, "a")
+	assert.FileExists(t, "b")
+	assert.NoFileExists(t, "z")
+	assert.NoDirExists(t, "dir2")
+
+	entries, err := os.ReadDir(temp)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestRunStdin(t *testing.T) {
+	temp := t.TempDir()
+	t.Chdir(temp)
+
+	tempFile(t, temp, "a")
+	tempFile(t, temp, "tab\tname")
+	tempFile(t, temp, " space ")
+
+	editDir := t.TempDir()
+	listing := filepath.Join(editDir, "listing")
+	buffer := filepath.Join(editDir, "buffer")
+	require.NoError(t, os.WriteFile(buffer, []byte("1\t\" space2 \"\n3\t\"tab\\tname2\"\n"), 0o666))
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'cp "$0" `+listing+` && cp `+buffer+` "$0"'`)
+
+	cmd := New(cmdutil.DisableTTY())
+	cmd.SetOut(io.Discard)
+	cmd.SetIn(strings.NewReader("tab\tname\x00 space \x00a\x00"))
+	cmd.SetArgs([]string{"--null", "-"})
+	require.NoError(t, cmd.Execute())
+
+	b, err := os.ReadFile(listing)
+	require.NoError(t, err)
+	assert.Equal(t, "1\t\" space \"\n2\ta\n3\t\"tab\\tname\"\n", string(b))
+
+	assert.FileExists(t, "tab\tname2")
+	assert.FileExists(t, " space2 ")
+	assert.NoFileExists(t, "a")
+}
+
+func TestRunLong(t *testing.T) {
+	temp := t.TempDir()
+	t.Chdir(temp)
+
+	tempFile(t, temp, "a")
+	require.NoError(t, os.Chmod("a", 0o644))
+	info, err := os.Lstat("a")
+	require.NoError(t, err)
+	a := newAttrs(info)
+
+	editDir := t.TempDir()
+	listing := filepath.Join(editDir, "listing")
+	buffer := filepath.Join(editDir, "buffer")
+	require.NoError(t, os.WriteFile(buffer, []byte("1\t0755\t"+a.owner+"\t2020-01-02 03:04:05\tb\n"), 0o666))
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'cp "$0" `+listing+` && cp `+buffer+` "$0"'`)
+
+	cmd := New(cmdutil.DisableTTY())
+	var buf strings.Builder
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"--long", "--verbose"})
+	require.NoError(t, cmd.Execute())
+
+	b, err := os.ReadFile(listing)
+	require.NoError(t, err)
+	assert.Equal(t, "1\t0644\t"+a.owner+"\t"+a.mtime+"\ta\n", string(b))
+
+	assert.Equal(t, `"a" => "b"
+chmod "b" 0644 => 0755
+touch "b" `+a.mtime+` => 2020-01-02 03:04:05
+`, buf.String())
+
+	info, err = os.Lstat("b")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local), info.ModTime())
+}
+
+func TestParseListing(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []entry
+		wantErr require.ErrorAssertionFunc
+	}{
+		{"rename", "1\tb", []entry{{index: 0, path: "b"}}, require.NoError},
+		{"quoted", "1\t\" b\\n\"", []entry{{index: 0, path: " b\n"}}, require.NoError},
+		{"quoted trailing text", "1\t\"b\" c", nil, require.Error},
+		{"invalid index", "3\tb", nil, require.Error},
+		{"blank", "  ", nil, require.NoError},
+		{"create", "b", []entry{{index: -1, path: "b"}}, require.NoError},
+		{"create dir", "b/", []entry{{index: -1, path: "b", dir: true}}, require.NoError},
+		{"create quoted", `"b\tc"`, []entry{{index: -1, path: "b\tc"}}, require.NoError},
+		{"symlink", "b -> a", []entry{{index: -1, path: "b", target: "a"}}, require.NoError},
+		{"symlink quoted", `"b " -> " a"`, []entry{{index: -1, path: "b ", target: " a"}}, require.NoError},
+		{"symlink missing target", "b ->", nil, require.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseListing(strings.NewReader(tt.line), 2, false)
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package vidir
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-tty"
+	"github.com/spf13/cobra"
+)
+
+// confirm prompts the user to apply the plan.
+// If forceTTY is true, the answer is read from "/dev/tty" instead of stdin.
+func confirm(cmd *cobra.Command, forceTTY bool) (bool, error) {
+	_, _ = fmt.Fprint(cmd.OutOrStdout(), "Apply changes? [y/N] ")
+
+	var answer string
+	if forceTTY {
+		t, err := tty.Open()
+		if err != nil {
+			return false, err
+		}
+		defer func() {
+			_ = t.Close()
+		}()
+
+		if answer, err = t.ReadString(); err != nil {
+			return false, err
+		}
+		_, _ = fmt.Fprintln(cmd.OutOrStdout())
+	} else {
+		var err error
+		if answer, err = bufio.NewReader(cmd.InOrStdin()).ReadString('\n'); err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
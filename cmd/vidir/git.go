@@ -0,0 +1,116 @@
+package vidir
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotGitRepo = errors.New("not inside a git work tree")
+
+// gitRepo moves and removes tracked paths with git so that the index follows the changes.
+// A nil gitRepo always falls back to plain filesystem operations.
+type gitRepo struct {
+	ctx  context.Context
+	root string
+}
+
+func newGitRepo(ctx context.Context) (*gitRepo, error) {
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotGitRepo, err)
+	}
+	return &gitRepo{ctx: ctx, root: strings.TrimSpace(string(out))}, nil
+}
+
+// run runs a git subcommand and returns its stdout.
+func (g *gitRepo) run(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(g.ctx, "git", args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// contains reports whether path is inside the work tree. The parent directory of path must exist.
+func (g *gitRepo) contains(path string) bool {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return false
+	}
+	return dir == g.root || isUnder(dir, g.root)
+}
+
+// tracked reports whether path, or anything inside of it, is tracked.
+func (g *gitRepo) tracked(path string) bool {
+	if g == nil || !g.contains(path) {
+		return false
+	}
+	_, err := g.run(nil, "ls-files", "--error-unmatch", "--", path)
+	return err == nil
+}
+
+// rename renames a path, using git mv if it is tracked and the destination is inside the work tree.
+// It reports whether git was used.
+func (g *gitRepo) rename(from, to string) (bool, error) {
+	if !g.tracked(from) || !g.contains(to) {
+		return false, os.Rename(from, to)
+	}
+	_, err := g.run(nil, "mv", "--", from, to)
+	return true, err
+}
+
+// undoRename reverts a rename performed by rename.
+func (g *gitRepo) undoRename(tracked bool, from, to string) error {
+	if !tracked {
+		return os.Rename(to, from)
+	}
+	_, err := g.run(nil, "mv", "--", to, from)
+	return err
+}
+
+// remove deletes a path which was moved by rename, including its index entries.
+func (g *gitRepo) remove(tracked bool, path string) error {
+	if tracked {
+		if _, err := g.run(nil, "rm", "-r", "-f", "-q", "--ignore-unmatch", "--", path); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(path)
+}
+
+// unstage removes the index entries of a path which no longer exists in the work tree.
+// It returns the removed entries so that they can be restored by restage.
+func (g *gitRepo) unstage(path string) ([]byte, error) {
+	entries, err := g.run(nil, "ls-files", "--stage", "-z", "--", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := g.run(nil, "rm", "-r", "-f", "-q", "--cached", "--", path); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// restage restores index entries returned by unstage.
+func (g *gitRepo) restage(entries []byte) error {
+	_, err := g.run(entries, "update-index", "-z", "--index-info")
+	return err
+}
@@ -0,0 +1,172 @@
+package vidir
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const gitignoreName = ".gitignore"
+
+// ignorePattern is a single pattern from a .gitignore file.
+type ignorePattern struct {
+	// base is the absolute path of the directory containing the .gitignore file.
+	base    string
+	pattern string
+	negate  bool
+	dirOnly bool
+	// anchored patterns are matched against the path relative to base instead of the file name.
+	anchored bool
+}
+
+// gitignore matches paths against patterns loaded from .gitignore files.
+type gitignore struct {
+	patterns []ignorePattern
+	loaded   map[string]struct{}
+}
+
+func newGitignore() *gitignore {
+	return &gitignore{loaded: make(map[string]struct{})}
+}
+
+// loadParents loads .gitignore files from the parent directories of dir up to the root of the git work tree.
+func (g *gitignore) loadParents(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	var dirs []string
+	for d := abs; ; {
+		if _, err := os.Lstat(filepath.Join(d, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			// Not inside a git work tree
+			return nil
+		}
+		d = parent
+		dirs = append(dirs, d)
+	}
+
+	for _, d := range slices.Backward(dirs) {
+		if err := g.load(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load reads the .gitignore file in dir if it exists.
+func (g *gitignore) load(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := g.loaded[abs]; ok {
+		return nil
+	}
+	g.loaded[abs] = struct{}{}
+
+	f, err := os.Open(filepath.Join(abs, gitignoreName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := parseIgnorePattern(abs, scanner.Text()); ok {
+			g.patterns = append(g.patterns, p)
+		}
+	}
+	return scanner.Err()
+}
+
+func parseIgnorePattern(base, line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, " ")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	p := ignorePattern{base: base}
+	if line, p.negate = strings.CutPrefix(line, "!"); !p.negate {
+		line = strings.TrimPrefix(line, `\`)
+	}
+	line, p.dirOnly = strings.CutSuffix(line, "/")
+	if trimmed, ok := strings.CutPrefix(line, "/"); ok {
+		line, p.anchored = trimmed, true
+	} else {
+		p.anchored = strings.Contains(line, "/")
+	}
+	p.pattern = line
+	return p, line != ""
+}
+
+// ignored reports whether a path is ignored. The last matching pattern wins.
+func (g *gitignore) ignored(name string, isDir bool) bool {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return false
+	}
+
+	var ignored bool
+	for _, p := range g.patterns {
+		if p.match(abs, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (p ignorePattern) match(abs string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	rel, err := filepath.Rel(p.base, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	if !p.anchored {
+		ok, _ := path.Match(p.pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(p.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where "**" matches any number of segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,305 @@
+package vidir
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// listing holds the paths which were written to the buffer.
+type listing struct {
+	paths []string
+	// attrs holds the metadata columns for each path if long is enabled.
+	attrs []attrs
+}
+
+// listOptions configures how the listing is created.
+type listOptions struct {
+	// maxDepth limits how many levels of directories are listed. 0 is unlimited.
+	maxDepth int
+	// all includes entries whose names begin with a dot.
+	all bool
+	// include lists only entries matching at least one of these globs.
+	include []string
+	// exclude skips entries matching any of these globs.
+	exclude []string
+	// gitignore skips entries which are ignored by .gitignore files.
+	gitignore bool
+	// sort is the listing sort order.
+	sort sortOrder
+	// long adds mode, owner, and modification time columns.
+	long bool
+	// stdin is read for a list of paths when "-" is passed as an argument.
+	stdin io.Reader
+	// null separates paths read from stdin with NUL instead of newline.
+	null bool
+}
+
+//go:generate go tool enumer -type sortOrder -trimprefix sort -transform lower -output sort_string.go
+
+type sortOrder uint8
+
+const (
+	sortName sortOrder = iota
+	sortMtime
+	sortSize
+)
+
+var ErrInvalidSort = errors.New("invalid sort")
+
+func createListing(w io.Writer, args []string, opts listOptions) (*listing, error) {
+	if len(args) == 0 {
+		args = append(args, ".")
+	}
+
+	paths := make([]string, 0, len(args))
+	seen := make(map[string]struct{}, len(args))
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			paths = append(paths, path)
+		}
+	}
+
+	var ignore *gitignore
+	if opts.gitignore {
+		ignore = newGitignore()
+	}
+
+	for _, arg := range args {
+		if arg == "-" {
+			if err := readList(opts.stdin, opts.null, add); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		glob, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, globPath := range glob {
+			if err := walk(globPath, opts, ignore, add); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	l := &listing{paths: paths}
+	var infos []fs.FileInfo
+	if opts.long || opts.sort != sortName {
+		infos = make([]fs.FileInfo, 0, len(paths))
+		for _, path := range paths {
+			info, err := os.Lstat(path)
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+	}
+
+	sortListing(l.paths, infos, opts.sort)
+
+	if opts.long {
+		l.attrs = make([]attrs, 0, len(paths))
+		for _, info := range infos {
+			l.attrs = append(l.attrs, newAttrs(info))
+		}
+	}
+
+	buf := bufio.NewWriter(w)
+	pad := strconv.FormatInt(int64(math.Log10(float64(len(paths)))+1), 10)
+	for i, path := range paths {
+		var err error
+		if opts.long {
+			_, err = fmt.Fprintf(buf, "%0"+pad+"d\t%s\t%s\n", i+1, l.attrs[i], formatPath(path))
+		} else {
+			_, err = fmt.Fprintf(buf, "%0"+pad+"d\t%s\n", i+1, formatPath(path))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return l, buf.Flush()
+}
+
+// walk lists the entries of root which pass the configured filters.
+// If root is not a directory, it is listed as-is.
+func walk(root string, opts listOptions, ignore *gitignore, fn func(string)) error {
+	if ignore != nil {
+		if err := ignore.loadParents(root); err != nil {
+			return err
+		}
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case path == root:
+			if !d.IsDir() {
+				fn(path)
+				return nil
+			}
+			if ignore != nil {
+				return ignore.load(path)
+			}
+			return nil
+		}
+
+		if skipEntry(root, path, d, opts, ignore) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if len(opts.include) == 0 || matchesAny(opts.include, root, path) {
+			fn(path)
+		}
+
+		if d.IsDir() {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			if opts.maxDepth > 0 && strings.Count(rel, string(filepath.Separator))+1 >= opts.maxDepth {
+				return filepath.SkipDir
+			}
+			if ignore != nil {
+				return ignore.load(path)
+			}
+		}
+		return nil
+	})
+}
+
+// skipEntry reports whether an entry found while walking is filtered out.
+func skipEntry(root, path string, d fs.DirEntry, opts listOptions, ignore *gitignore) bool {
+	switch {
+	case !opts.all && strings.HasPrefix(d.Name(), "."):
+		return true
+	case matchesAny(opts.exclude, root, path):
+		return true
+	case ignore != nil && (d.Name() == ".git" || ignore.ignored(path, d.IsDir())):
+		return true
+	}
+	return false
+}
+
+// matchesAny reports whether the path's name or its path relative to root matches any of the globs.
+func matchesAny(patterns []string, root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		rel = path
+	}
+	name := filepath.Base(path)
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		ok, _ := filepath.Match(pattern, rel)
+		return ok
+	})
+}
+
+// sortListing sorts paths and their infos in place. Names sort each path component in turn, so
+// directories are followed by their contents, while modification time and size sort the newest and
+// largest entries first. infos may be nil when sorting by name.
+func sortListing(paths []string, infos []fs.FileInfo, by sortOrder) {
+	var compare func(i, j int) int
+	switch by {
+	case sortMtime:
+		compare = func(i, j int) int { return infos[j].ModTime().Compare(infos[i].ModTime()) }
+	case sortSize:
+		compare = func(i, j int) int { return cmp.Compare(infos[j].Size(), infos[i].Size()) }
+	default:
+		compare = func(i, j int) int {
+			return slices.Compare(
+				strings.Split(paths[i], string(filepath.Separator)),
+				strings.Split(paths[j], string(filepath.Separator)),
+			)
+		}
+	}
+
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, compare)
+
+	sorted := make([]string, 0, len(paths))
+	var sortedInfos []fs.FileInfo
+	if infos != nil {
+		sortedInfos = make([]fs.FileInfo, 0, len(infos))
+	}
+	for _, i := range order {
+		sorted = append(sorted, paths[i])
+		if infos != nil {
+			sortedInfos = append(sortedInfos, infos[i])
+		}
+	}
+	copy(paths, sorted)
+	copy(infos, sortedInfos)
+}
+
+// readList reads a newline or NUL separated list of paths.
+func readList(r io.Reader, null bool, fn func(string)) error {
+	scanner := bufio.NewScanner(r)
+	if null {
+		scanner.Split(scanNull)
+	}
+	for scanner.Scan() {
+		if path := scanner.Text(); path != "" {
+			fn(path)
+		}
+	}
+	return scanner.Err()
+}
+
+// scanNull is a bufio.SplitFunc which splits on NUL bytes.
+func scanNull(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// formatPath quotes a path if it would not survive a round trip through the buffer.
+func formatPath(path string) string {
+	if needsQuote(path) {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+func needsQuote(path string) bool {
+	switch {
+	case strings.HasPrefix(path, `"`),
+		strings.TrimSpace(path) != path,
+		!utf8.ValidString(path):
+		return true
+	}
+	return strings.ContainsFunc(path, unicode.IsControl)
+}
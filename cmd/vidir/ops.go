@@ -0,0 +1,287 @@
+package vidir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gabe565.com/moreutils/internal/trash"
+)
+
+// op is a single filesystem operation in a plan.
+type op interface {
+	fmt.Stringer
+	// marker returns the diff marker used when previewing the operation.
+	marker() byte
+	// apply performs the operation.
+	apply() error
+	// undo reverts a successfully applied operation.
+	undo() error
+}
+
+// committer is implemented by operations which need to be finalized after the whole plan has been applied.
+type committer interface {
+	commit() error
+}
+
+// renameOp renames a path.
+type renameOp struct {
+	from, to string
+	parents  []string
+	git      *gitRepo
+	// tracked is true if the rename was performed with git.
+	tracked bool
+}
+
+func (o *renameOp) String() string { return fmt.Sprintf("%q => %q", o.from, o.to) }
+
+func (o *renameOp) marker() byte { return '~' }
+
+func (o *renameOp) apply() error {
+	var err error
+	if o.parents, err = mkdirAll(filepath.Dir(o.to)); err != nil {
+		return err
+	}
+	if o.tracked, err = o.git.rename(o.from, o.to); err != nil {
+		return errors.Join(err, removeDirs(o.parents))
+	}
+	return nil
+}
+
+func (o *renameOp) undo() error {
+	return errors.Join(o.git.undoRename(o.tracked, o.from, o.to), removeDirs(o.parents))
+}
+
+// removeOp removes a path.
+// The path is first moved to a backup location so that it can be restored if the plan fails.
+// If trash is true, the trash is used as the backup location, and the entry is left there.
+// If git is set, tracked entries are also removed from the index.
+type removeOp struct {
+	path   string
+	backup string
+	// final is the backup location once the rest of the plan has been applied.
+	final string
+	trash bool
+	item  *trash.Item
+	git   *gitRepo
+	// tracked is true if the removal was performed with git.
+	tracked bool
+	// index holds the index entries which were removed along with a trashed path.
+	index []byte
+}
+
+func (o *removeOp) String() string {
+	if o.trash {
+		return fmt.Sprintf("trashed %q", o.path)
+	}
+	return fmt.Sprintf("removed %q", o.path)
+}
+
+func (o *removeOp) marker() byte { return '-' }
+
+func (o *removeOp) apply() error {
+	var err error
+	if !o.trash {
+		o.tracked, err = o.git.rename(o.path, o.backup)
+		return err
+	}
+
+	o.tracked = o.git.tracked(o.path)
+	if o.item, err = trash.Put(o.path); err != nil {
+		return err
+	}
+	if o.tracked {
+		if o.index, err = o.git.unstage(o.path); err != nil {
+			return errors.Join(err, o.item.Restore())
+		}
+	}
+	return nil
+}
+
+func (o *removeOp) undo() error {
+	if !o.trash {
+		return o.git.undoRename(o.tracked, o.path, o.backup)
+	}
+
+	if err := o.item.Restore(); err != nil {
+		return err
+	}
+	if o.tracked {
+		return o.git.restage(o.index)
+	}
+	return nil
+}
+
+func (o *removeOp) commit() error {
+	if o.trash {
+		return nil
+	}
+	return o.git.remove(o.tracked, o.final)
+}
+
+// copyOp copies a path. Directories are copied recursively.
+type copyOp struct {
+	from, to string
+	parents  []string
+}
+
+func (o *copyOp) String() string { return fmt.Sprintf("copied %q => %q", o.from, o.to) }
+
+func (o *copyOp) marker() byte { return '+' }
+
+func (o *copyOp) apply() error {
+	var err error
+	if o.parents, err = mkdirAll(filepath.Dir(o.to)); err != nil {
+		return err
+	}
+	if err := copyPath(o.from, o.to); err != nil {
+		return errors.Join(err, os.RemoveAll(o.to), removeDirs(o.parents))
+	}
+	return nil
+}
+
+func (o *copyOp) undo() error {
+	return errors.Join(os.RemoveAll(o.to), removeDirs(o.parents))
+}
+
+// createOp creates an empty file, a directory, or a symlink.
+type createOp struct {
+	path    string
+	dir     bool
+	target  string
+	parents []string
+}
+
+func (o *createOp) String() string {
+	if o.target != "" {
+		return fmt.Sprintf("linked %q -> %q", o.path, o.target)
+	}
+	return fmt.Sprintf("created %q", o.path)
+}
+
+func (o *createOp) marker() byte { return '+' }
+
+func (o *createOp) apply() error {
+	var err error
+	if o.dir {
+		o.parents, err = mkdirAll(o.path)
+		return err
+	}
+
+	if o.parents, err = mkdirAll(filepath.Dir(o.path)); err != nil {
+		return err
+	}
+
+	if o.target != "" {
+		err = os.Symlink(o.target, o.path)
+	} else {
+		var f *os.File
+		if f, err = os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666); err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		return errors.Join(err, removeDirs(o.parents))
+	}
+	return nil
+}
+
+func (o *createOp) undo() error {
+	if o.dir {
+		return removeDirs(o.parents)
+	}
+	return errors.Join(os.Remove(o.path), removeDirs(o.parents))
+}
+
+// mkdirAll is like os.MkdirAll, but it returns the directories which were created.
+func mkdirAll(path string) ([]string, error) {
+	var missing []string
+	for p := path; ; p = filepath.Dir(p) {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		missing = append(missing, p)
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	slices.Reverse(missing)
+	for i, p := range missing {
+		if err := os.Mkdir(p, 0o777); err != nil {
+			return nil, errors.Join(err, removeDirs(missing[:i]))
+		}
+	}
+	return missing, nil
+}
+
+// removeDirs removes directories created by mkdirAll in reverse order.
+func removeDirs(dirs []string) error {
+	var errs []error
+	for _, dir := range slices.Backward(dirs) {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// copyPath copies a file, directory, or symlink. Directories are copied recursively.
+func copyPath(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
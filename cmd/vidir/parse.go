@@ -0,0 +1,148 @@
+package vidir
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidIndex = errors.New("invalid index")
+	ErrEmptyPath    = errors.New("empty path")
+	ErrTrailingText = errors.New("unexpected text after quoted path")
+	ErrFieldCount   = errors.New("invalid field count")
+)
+
+// entry is a single parsed line from the edited listing.
+type entry struct {
+	// index is the zero-based listing index, or -1 for new entries.
+	index int
+	path  string
+	// dir is true when a new entry should be created as a directory.
+	dir bool
+	// target is the symlink target when a new entry should be created as a symlink.
+	target string
+	// attrs holds the metadata columns of a long listing.
+	attrs *attrs
+}
+
+const symlinkSep = " ->"
+
+// parseListing parses an edited listing containing n original paths.
+// If long is true, numbered lines are expected to contain metadata columns.
+func parseListing(r io.Reader, n int, long bool) ([]entry, error) {
+	var entries []entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		num, path, found := bytes.Cut(line, []byte("\t"))
+		if !found {
+			e, err := parseNew(string(line))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+			continue
+		}
+
+		i, err := strconv.Atoi(string(num))
+		if err != nil {
+			return nil, err
+		}
+		i--
+		if i < 0 || i > n-1 {
+			return nil, fmt.Errorf("%w: %d", ErrInvalidIndex, i+1)
+		}
+		var a *attrs
+		if long {
+			fields := strings.SplitN(string(path), "\t", attrsFields+1)
+			if len(fields) != attrsFields+1 {
+				return nil, fmt.Errorf("%w: %d", ErrFieldCount, len(fields)+1)
+			}
+			a = new(parseAttrs(fields))
+			path = []byte(fields[attrsFields])
+		}
+
+		name, rest, err := unquotePath(string(path))
+		if err != nil {
+			return nil, err
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("%w: %q", ErrTrailingText, rest)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%w: %d", ErrEmptyPath, i+1)
+		}
+
+		entries = append(entries, entry{index: i, path: filepath.Clean(name), attrs: a})
+	}
+	return entries, scanner.Err()
+}
+
+// parseNew parses an unnumbered line.
+func parseNew(line string) (entry, error) {
+	e := entry{index: -1}
+
+	var path, target string
+	var isLink bool
+	if strings.HasPrefix(line, `"`) {
+		var rest string
+		var err error
+		if path, rest, err = unquotePath(line); err != nil {
+			return e, err
+		}
+		if target, isLink = strings.CutPrefix(rest, symlinkSep); !isLink && rest != "" {
+			return e, fmt.Errorf("%w: %q", ErrTrailingText, rest)
+		}
+	} else {
+		path, target, isLink = strings.Cut(line, symlinkSep)
+	}
+
+	if isLink {
+		target, rest, err := unquotePath(strings.TrimSpace(target))
+		switch {
+		case err != nil:
+			return e, err
+		case rest != "":
+			return e, fmt.Errorf("%w: %q", ErrTrailingText, rest)
+		case target == "":
+			return e, fmt.Errorf("%w: symlink target for %q", ErrEmptyPath, path)
+		}
+		e.target = target
+	} else if p, ok := strings.CutSuffix(path, "/"); ok {
+		path, e.dir = p, true
+	}
+
+	if path == "" {
+		return e, fmt.Errorf("%w: %q", ErrEmptyPath, line)
+	}
+	e.path = filepath.Clean(path)
+	return e, nil
+}
+
+// unquotePath parses a path which may be double-quoted.
+// For quoted paths, any text following the closing quote is also returned.
+func unquotePath(s string) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, "", nil
+	}
+
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", fmt.Errorf("parse %s: %w", s, err)
+	}
+	path, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", "", fmt.Errorf("parse %s: %w", quoted, err)
+	}
+	return path, s[len(quoted):], nil
+}
@@ -0,0 +1,437 @@
+package vidir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var (
+	ErrExists       = errors.New("path already exists")
+	ErrDirNotEmpty  = errors.New("directory not empty")
+	ErrMoveIntoSelf = errors.New("cannot move a directory into itself")
+	ErrCopyIntoSelf = errors.New("cannot copy a directory into itself")
+	ErrUnresolvable = errors.New("unable to resolve renames")
+)
+
+// plan is an ordered list of operations which is applied as a transaction.
+type plan []op
+
+// Print writes a diff-like preview of the plan.
+func (p plan) Print(w io.Writer) error {
+	for _, op := range p {
+		if _, err := fmt.Fprintf(w, "%c %s\n", op.marker(), op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply applies each operation in order. If an operation fails, all previously applied operations are undone.
+func (p plan) Apply(w io.Writer, verbose bool) error {
+	for i, op := range p {
+		if verbose {
+			_, _ = fmt.Fprintln(w, op)
+		}
+		if err := op.apply(); err != nil {
+			err = fmt.Errorf("%s: %w", op, err)
+			if undoErr := p[:i].undo(); undoErr != nil {
+				err = errors.Join(err, fmt.Errorf("rollback failed: %w", undoErr))
+			}
+			return err
+		}
+	}
+
+	var errs []error
+	for _, op := range p {
+		if op, ok := op.(committer); ok {
+			if err := op.commit(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", op, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// undo reverts operations in reverse order.
+func (p plan) undo() error {
+	var errs []error
+	for _, op := range slices.Backward(p) {
+		if err := op.undo(); err != nil {
+			errs = append(errs, fmt.Errorf("undo %s: %w", op, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// planOptions configures how renames and removals are planned.
+type planOptions struct {
+	// removeRecursive allows removing non-empty directories.
+	removeRecursive bool
+	// trash moves removed entries to the trash instead of deleting them.
+	trash bool
+	// git moves and removes tracked entries with git if set.
+	git *gitRepo
+}
+
+// newPlan computes the operations required to turn the listed paths into the edited entries.
+//
+// Renames and removals are ordered so that every destination is free before it is used.
+// Cycles (e.g. swapping two names) are broken by moving an entry to a temporary name in its destination directory.
+// When a directory is renamed, entries inside of it follow, so nested paths always end up where the buffer says.
+func newPlan(l *listing, entries []entry, opts planOptions) (plan, error) {
+	paths := l.paths
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	dests := make([]string, len(paths))
+	kept := make([]bool, len(paths))
+	var copies, creates []entry
+	for _, e := range entries {
+		switch {
+		case e.index == -1:
+			creates = append(creates, e)
+		case kept[e.index]:
+			copies = append(copies, e)
+		default:
+			kept[e.index] = true
+			dests[e.index] = e.path
+		}
+	}
+
+	p := &planner{
+		opts:  opts,
+		state: make(map[string]pathState, len(paths)),
+		temps: make(map[string]struct{}),
+	}
+
+	vacated := make(map[string]bool, len(paths))
+	for i, path := range paths {
+		vacated[path] = !kept[i] || dests[i] != path
+		if vacated[path] {
+			p.state[path] = pathState{}
+		}
+	}
+
+	for i, path := range paths {
+		switch {
+		case !kept[i]:
+			p.pending = append(p.pending, &move{src: path, remove: true})
+		case dests[i] != path || p.vacatedAncestor(path):
+			// Entries which stay in place are moved back if a parent directory is renamed
+			if isUnder(dests[i], path) {
+				return nil, fmt.Errorf("%q => %q: %w", path, dests[i], ErrMoveIntoSelf)
+			}
+			p.pending = append(p.pending, &move{src: path, dst: dests[i]})
+		}
+	}
+
+	for _, m := range p.pending {
+		if m.remove {
+			continue
+		}
+		if exists, err := p.exists(m.dst); err != nil {
+			return nil, err
+		} else if exists {
+			return nil, fmt.Errorf("%q => %q: %w", m.src, m.dst, ErrExists)
+		}
+		p.state[m.dst] = pathState{exists: true, src: m.src}
+	}
+
+	for _, m := range p.pending {
+		if m.remove {
+			if err := checkEmpty(m.src, vacated, opts.removeRecursive || opts.trash); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := p.resolve(); err != nil {
+		return nil, err
+	}
+
+	for _, e := range copies {
+		if isUnder(e.path, dests[e.index]) {
+			return nil, fmt.Errorf("%q => %q: %w", dests[e.index], e.path, ErrCopyIntoSelf)
+		}
+		o := &copyOp{from: dests[e.index], to: e.path}
+		if err := p.create(e.path, paths[e.index], o); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range entries {
+		if e.attrs == nil {
+			continue
+		}
+		ops, err := e.attrs.ops(e.path, paths[e.index], l.attrs[e.index])
+		if err != nil {
+			return nil, err
+		}
+		p.plan = append(p.plan, ops...)
+	}
+
+	for _, e := range creates {
+		if err := p.create(e.path, "", &createOp{path: e.path, dir: e.dir, target: e.target}); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.plan, nil
+}
+
+// move is a pending rename or removal.
+type move struct {
+	src, dst string
+	remove   bool
+	// temp is true once the entry has been moved to a temporary name.
+	temp bool
+}
+
+// pathState records whether a path will exist once the plan is applied.
+type pathState struct {
+	exists bool
+	// src is the original location of the path's contents, or empty for new paths.
+	src string
+}
+
+// planner tracks the expected filesystem state while a plan is built.
+type planner struct {
+	opts     planOptions
+	state    map[string]pathState
+	temps    map[string]struct{}
+	pending  []*move
+	removals []*removeOp
+	plan     plan
+}
+
+// exists reports whether a path will exist once the planned operations are applied.
+func (p *planner) exists(path string) (bool, error) {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if s, ok := p.state[dir]; ok {
+			switch {
+			case !s.exists:
+				return false, nil
+			case dir == path:
+				return true, nil
+			case s.src == "":
+				return false, nil
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return false, err
+			}
+			path = filepath.Join(s.src, rel)
+			if s, ok := p.state[path]; ok && !s.exists {
+				return false, nil
+			}
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	return lexists(path)
+}
+
+// vacatedAncestor reports whether any parent directory of path is renamed or removed.
+func (p *planner) vacatedAncestor(path string) bool {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if s, ok := p.state[dir]; ok && !s.exists {
+			return true
+		}
+		if filepath.Dir(dir) == dir {
+			return false
+		}
+	}
+}
+
+// resolve orders the pending moves, breaking cycles with temporary names.
+func (p *planner) resolve() error {
+	for len(p.pending) != 0 {
+		i := slices.IndexFunc(p.pending, p.ready)
+		if i == -1 {
+			// Every remaining move is blocked by another, so move one out of the way
+			i = slices.IndexFunc(p.pending, func(m *move) bool {
+				return !m.remove && !m.temp && !p.hasMovingAncestor(m)
+			})
+			if i == -1 {
+				return ErrUnresolvable
+			}
+
+			m := p.pending[i]
+			tmp, err := p.tempName(filepath.Dir(m.dst), filepath.Base(m.src))
+			if err != nil {
+				return err
+			}
+			p.rename(m.src, tmp)
+			m.src, m.temp = tmp, true
+			continue
+		}
+
+		m := p.pending[i]
+		p.pending = slices.Delete(p.pending, i, i+1)
+		switch {
+		case m.remove:
+			// Removed entries are kept in a temporary location until the whole plan succeeds
+			backup, err := p.tempName(filepath.Dir(m.src), filepath.Base(m.src))
+			if err != nil {
+				return err
+			}
+			for _, o := range p.removals {
+				o.final = replacePrefix(o.final, m.src, backup)
+			}
+			o := &removeOp{path: m.src, backup: backup, final: backup, trash: p.opts.trash, git: p.opts.git}
+			p.plan = append(p.plan, o)
+			p.removals = append(p.removals, o)
+		case m.src != m.dst:
+			p.rename(m.src, m.dst)
+		}
+	}
+	return nil
+}
+
+// ready reports whether a move can be applied without disturbing any other pending move.
+func (p *planner) ready(m *move) bool {
+	for _, o := range p.pending {
+		switch {
+		case o == m:
+		case m.remove:
+			// Entries inside a removed directory must be moved out first
+			if isUnder(o.src, m.src) {
+				return false
+			}
+		case o.src == m.dst, isUnder(m.dst, o.src):
+			// Destination is still occupied
+			return false
+		case !o.remove && isUnder(m.src, o.src):
+			// Parent directories are renamed first
+			return false
+		case !o.remove && (o.dst == m.dst || isUnder(m.dst, o.dst)):
+			// Destination directories are created by their own rename first
+			return false
+		}
+	}
+	return true
+}
+
+// hasMovingAncestor reports whether a parent directory of the move's source is still pending a rename.
+func (p *planner) hasMovingAncestor(m *move) bool {
+	return slices.ContainsFunc(p.pending, func(o *move) bool {
+		return !o.remove && isUnder(m.src, o.src)
+	})
+}
+
+// rename appends a rename and updates pending moves and removal backups inside the renamed path.
+func (p *planner) rename(from, to string) {
+	p.plan = append(p.plan, &renameOp{from: from, to: to, git: p.opts.git})
+	for _, o := range p.pending {
+		o.src = replacePrefix(o.src, from, to)
+	}
+	for _, o := range p.removals {
+		o.final = replacePrefix(o.final, from, to)
+	}
+}
+
+// tempName returns an unused temporary name in dir.
+func (p *planner) tempName(dir, base string) (string, error) {
+	base = ".vidir-" + base
+	for n := 0; ; n++ {
+		name := base
+		if n != 0 {
+			name += "-" + strconv.Itoa(n)
+		}
+		name = filepath.Join(dir, name)
+
+		if _, ok := p.temps[name]; ok {
+			continue
+		}
+		if exists, err := lexists(name); err != nil || exists {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		if exists, err := p.exists(name); err != nil {
+			return "", err
+		} else if !exists {
+			p.temps[name] = struct{}{}
+			return name, nil
+		}
+	}
+}
+
+// create appends an operation which creates a new path.
+func (p *planner) create(path, src string, o op) error {
+	if exists, err := p.exists(path); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("%s: %w", o, ErrExists)
+	}
+
+	p.plan = append(p.plan, o)
+	p.state[path] = pathState{exists: true, src: src}
+	return nil
+}
+
+// checkEmpty returns an error if a directory contains anything other than vacated entries.
+// If recursive is true, only listed entries which are kept cause an error.
+func checkEmpty(path string, vacated map[string]bool, recursive bool) error {
+	info, err := os.Lstat(path)
+	if err != nil || !info.IsDir() {
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := filepath.Join(path, entry.Name())
+		vacated, listed := vacated[name]
+		switch {
+		case vacated:
+		case listed:
+			return fmt.Errorf("remove %q: %w: %q is kept", path, ErrDirNotEmpty, name)
+		case !recursive:
+			return fmt.Errorf("remove %q: %w", path, ErrDirNotEmpty)
+		}
+	}
+	return nil
+}
+
+// lexists reports whether a path currently exists without following symlinks.
+func lexists(path string) (bool, error) {
+	if _, err := os.Lstat(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// isUnder reports whether path is inside dir.
+func isUnder(path, dir string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// replacePrefix replaces the directory prefix of path if it is inside dir.
+func replacePrefix(path, dir, repl string) string {
+	if rel, ok := strings.CutPrefix(path, dir+string(filepath.Separator)); ok {
+		return filepath.Join(repl, rel)
+	}
+	return path
+}
@@ -0,0 +1,81 @@
+package vipe
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// buffer is the file which is opened in the editor.
+type buffer struct {
+	path string
+	// dir is the private directory containing the buffer, if any.
+	dir string
+	// memfd is held open for the lifetime of a memory-backed buffer.
+	memfd *os.File
+}
+
+// newBuffer creates an empty buffer file.
+// If memfd is true, the buffer is memory-backed and never written to disk.
+// Otherwise, it is created with 0600 permissions in a private directory inside tempDir.
+func newBuffer(tempDir, suffix string, memfd bool) (*buffer, error) {
+	if memfd {
+		f, path, err := createMemfd("vipe" + suffix)
+		if err != nil {
+			return nil, err
+		}
+		return &buffer{path: path, memfd: f}, nil
+	}
+
+	dir, err := os.MkdirTemp(tempDir, "vipe-*")
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, "buffer"+suffix)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, errors.Join(err, os.RemoveAll(dir))
+	}
+	if err := f.Close(); err != nil {
+		return nil, errors.Join(err, os.RemoveAll(dir))
+	}
+	return &buffer{path: path, dir: dir}, nil
+}
+
+// Close overwrites the buffer with zeros, then removes it along with any files the editor left behind.
+func (b *buffer) Close() error {
+	if b.memfd != nil {
+		return b.memfd.Close()
+	}
+	return errors.Join(wipe(b.path), os.RemoveAll(b.dir))
+}
+
+// wipe overwrites a file with zeros.
+func wipe(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Join(err, f.Close())
+	}
+
+	if _, err := io.CopyN(f, zeroReader{}, info.Size()); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	return errors.Join(f.Sync(), f.Close())
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -1,6 +1,9 @@
 package vipe
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -8,6 +11,7 @@ import (
 
 	"gabe565.com/moreutils/internal/cmdutil"
 	"gabe565.com/moreutils/internal/editor"
+	"gabe565.com/moreutils/internal/util"
 	"gabe565.com/utils/cobrax"
 	"gabe565.com/utils/must"
 	"gabe565.com/utils/termx"
@@ -15,20 +19,47 @@ import (
 )
 
 const (
-	Name       = "vipe"
-	FlagSuffix = "suffix"
+	Name        = "vipe"
+	FlagSuffix  = "suffix"
+	FlagAbort   = "abort"
+	FlagJSON    = "json"
+	FlagMinify  = "minify"
+	FlagTempDir = "temp-dir"
+	FlagMemfd   = "memfd"
+	FlagInPlace = "in-place"
 )
 
 func New(opts ...cobrax.Option) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:     Name + " [file]",
-		Short:   "Insert a text editor into a pipe",
+		Use:   Name + " [file]",
+		Short: "Insert a text editor into a pipe",
+		Long: `Insert a text editor into a pipe.
+
+With --json, the input is pretty-printed before the editor is opened, and the
+buffer is validated once the editor exits. If the buffer is invalid, the editor
+is reopened with the error shown in "#" comment lines at the top of the buffer.
+Empty the buffer or exit the editor with an error to give up.
+
+The buffer is created with 0600 permissions in a private directory, and it is
+overwritten with zeros before it is removed. With --memfd, the buffer is kept in
+memory and never written to disk. Some editors save by replacing the file, which
+is not possible with --memfd.
+
+With --in-place, the edited buffer is written back to the file instead of stdout.
+The file is replaced atomically when possible.`,
 		Args:    cobra.MaximumNArgs(1),
 		RunE:    run,
 		GroupID: cmdutil.Applet,
 	}
 
 	cmd.Flags().StringP(FlagSuffix, "s", "txt", "File extension to use for the temp buffer file")
+	cmd.Flags().BoolP(FlagAbort, "a", false, "Exit with an error instead of writing output if the buffer is unchanged or empty")
+	cmd.Flags().BoolP(FlagJSON, "j", false, "Pretty-print JSON before editing and validate it after")
+	cmd.Flags().BoolP(FlagMinify, "m", false, "Minify JSON after editing (implies --json)")
+	cmd.Flags().String(FlagTempDir, "", "Directory to create the temp buffer in (default $TMPDIR)")
+	cmd.Flags().Bool(FlagMemfd, false, "Keep the buffer in memory instead of on disk (Linux only)")
+	cmd.MarkFlagsMutuallyExclusive(FlagTempDir, FlagMemfd)
+	cmd.Flags().BoolP(FlagInPlace, "i", false, "Write the result back to the file instead of stdout")
 
 	for _, opt := range opts {
 		opt(cmd)
@@ -36,14 +67,37 @@ func New(opts ...cobrax.Option) *cobra.Command {
 	return cmd
 }
 
+var (
+	ErrAborted   = errors.New("aborted")
+	ErrUnchanged = errors.New("buffer is unchanged")
+	ErrEmpty     = errors.New("buffer is empty")
+	ErrNoFile    = errors.New("--" + FlagInPlace + " requires a file")
+)
+
 func run(cmd *cobra.Command, args []string) error {
 	cmd.SilenceUsage = true
 
+	inPlace := must.Must2(cmd.Flags().GetBool(FlagInPlace))
+	if inPlace && len(args) == 0 {
+		return ErrNoFile
+	}
+
+	minify := must.Must2(cmd.Flags().GetBool(FlagMinify))
+	var h *hook
+	if minify || must.Must2(cmd.Flags().GetBool(FlagJSON)) {
+		h = jsonHook(minify)
+	}
+
 	suffix := must.Must2(cmd.Flags().GetString(FlagSuffix))
 
-	if len(args) != 0 && !cmd.Flags().Changed(FlagSuffix) {
-		if v := filepath.Ext(args[0]); v != "" {
-			suffix = v
+	if !cmd.Flags().Changed(FlagSuffix) {
+		if h != nil {
+			suffix = h.suffix
+		}
+		if len(args) != 0 {
+			if v := filepath.Ext(args[0]); v != "" {
+				suffix = v
+			}
 		}
 	}
 
@@ -51,55 +105,119 @@ func run(cmd *cobra.Command, args []string) error {
 		suffix = "." + suffix
 	}
 
-	tmp, err := os.CreateTemp("", "vipe-*"+suffix)
+	buf, err := newBuffer(
+		must.Must2(cmd.Flags().GetString(FlagTempDir)),
+		suffix,
+		must.Must2(cmd.Flags().GetBool(FlagMemfd)),
+	)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		_ = tmp.Close()
-		_ = os.Remove(tmp.Name())
+		_ = buf.Close()
 	}()
 
-	switch {
-	case len(args) != 0:
-		f, err := os.Open(args[0])
-		if err != nil {
-			return err
-		}
-
-		_, err = io.Copy(tmp, f)
-		_ = f.Close()
+	data, err := readInput(cmd, args)
+	if err != nil {
+		return err
+	}
 
-		if err != nil {
-			return err
-		}
-	case !termx.IsTerminal(cmd.InOrStdin()):
-		if _, err := io.Copy(tmp, cmd.InOrStdin()); err != nil {
-			return err
+	var header error
+	if h != nil && len(bytes.TrimSpace(data)) != 0 {
+		if pretty, err := h.pre(data); err != nil {
+			header = err
+		} else {
+			data = pretty
 		}
 	}
 
-	if err := tmp.Close(); err != nil {
+	if err := os.WriteFile(buf.path, withHeader(data, header), 0o600); err != nil {
 		return err
 	}
 
-	_, disableTTY := cmd.Annotations[cmdutil.DisableTTYAnnotation]
-	if err := editor.Edit(cmd.Context(), tmp.Name(), !disableTTY); err != nil {
+	data, err = edit(cmd, buf.path, data, h, must.Must2(cmd.Flags().GetBool(FlagAbort)), errorPosition(header))
+	if err != nil {
 		return err
 	}
 
-	tmp, err = os.Open(tmp.Name())
+	if inPlace {
+		return writeFile(args[0], data)
+	}
+
+	_, err = cmd.OutOrStdout().Write(data)
+	return err
+}
+
+// writeFile replaces the contents of a file.
+func writeFile(path string, data []byte) error {
+	f, err := util.CreateReplaceFile(path)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		_ = tmp.Close()
-		_ = os.Remove(tmp.Name())
+		_ = f.Close()
 	}()
 
-	if _, err := io.Copy(cmd.OutOrStdout(), tmp); err != nil {
+	if _, err := f.Write(data); err != nil {
 		return err
 	}
+	return f.Commit()
+}
 
-	return nil
+// readInput reads the file argument, or stdin if it is not a terminal.
+func readInput(cmd *cobra.Command, args []string) ([]byte, error) {
+	switch {
+	case len(args) != 0:
+		return os.ReadFile(args[0])
+	case !termx.IsTerminal(cmd.InOrStdin()):
+		return io.ReadAll(cmd.InOrStdin())
+	}
+	return nil, nil
+}
+
+// edit opens the editor until the buffer passes the hook's validation, then returns the result.
+// orig is the buffer contents before the first edit, used to detect unchanged buffers if abort is true.
+// The cursor is placed at pos, and then at the position of each validation error.
+func edit(cmd *cobra.Command, path string, orig []byte, h *hook, abort bool, pos editor.Position) ([]byte, error) {
+	_, disableTTY := cmd.Annotations[cmdutil.DisableTTYAnnotation]
+	for {
+		if err := editor.EditFiles(cmd.Context(), []string{path}, pos, !disableTTY); err != nil {
+			return nil, err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if h != nil {
+			data = stripHeader(data)
+		}
+
+		if abort {
+			switch {
+			case len(data) == 0:
+				return nil, fmt.Errorf("%w: %w", ErrAborted, ErrEmpty)
+			case bytes.Equal(data, orig):
+				return nil, fmt.Errorf("%w: %w", ErrAborted, ErrUnchanged)
+			}
+		}
+
+		if h == nil {
+			return data, nil
+		}
+
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil, fmt.Errorf("%w: %w", ErrAborted, ErrEmpty)
+		}
+
+		result, err := h.post(data)
+		if err == nil {
+			return result, nil
+		}
+
+		if err := os.WriteFile(path, withHeader(data, err), 0o600); err != nil {
+			return nil, err
+		}
+		pos = errorPosition(err)
+	}
 }
@@ -2,6 +2,7 @@ package vipe
 
 import (
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
@@ -38,9 +39,19 @@ func TestVipe(t *testing.T) {
 		{"run", sed, nil, "test\n", "testing\n", false, require.NoError},
 		{"suffix", `sh -c 'echo "$0" >"$0"'`, []string{"--suffix=bin"}, "", ".*.bin\n", true, require.NoError},
 		{"file", sed, []string{tmp.Name()}, "", "testing\n", true, require.NoError},
+		{"abort changed", sed, []string{"--abort"}, "test\n", "testing\n", false, require.NoError},
+		{"abort unchanged", "true", []string{"--abort"}, "test\n", "", false, errorIs(ErrUnchanged)},
+		{"abort empty", `sh -c ': > "$0"'`, []string{"--abort"}, "test\n", "", false, errorIs(ErrEmpty)},
+		{"abort editor error", "false", nil, "test\n", "", false, require.Error},
+		{"json", "true", []string{"--json"}, `{"a":[1,2]}`, "{\n  \"a\": [\n    1,\n    2\n  ]\n}\n", false, require.NoError},
+		{"json trailing newline", "true", []string{"--json"}, "[1]\n", "[\n  1\n]\n", false, require.NoError},
+		{"json suffix", `sh -c 'echo "\"$0\"" >"$0"'`, []string{"--json"}, "", `".*\.json"\n`, true, require.NoError},
+		{"json empty", `sh -c ': > "$0"'`, []string{"--json"}, "{}", "", false, errorIs(ErrEmpty)},
+		{"minify", "true", []string{"--minify"}, "{\n  \"a\": 1\n}\n", "{\"a\":1}\n", false, require.NoError},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VISUAL", "")
 			t.Setenv("EDITOR", tt.editor)
 			cmd := New(cmdutil.DisableTTY())
 			cmd.SetArgs(tt.args)
@@ -56,3 +67,93 @@ func TestVipe(t *testing.T) {
 		})
 	}
 }
+
+func TestVipeJSONRetry(t *testing.T) {
+	temp := t.TempDir()
+	seen := filepath.Join(temp, "seen")
+
+	// Write invalid JSON on the first run, then save the reopened buffer and fix it
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'if [ -e "`+seen+`" ]; then cp "$0" "`+seen+`.2"; echo "[1]" > "$0"; else touch "`+seen+`"; echo "[" > "$0"; fi'`)
+	cmd := New(cmdutil.DisableTTY())
+	cmd.SetArgs([]string{"--json"})
+	cmd.SetIn(strings.NewReader("[]"))
+	var stdout strings.Builder
+	cmd.SetOut(&stdout)
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "[1]\n", stdout.String())
+
+	reopened, err := os.ReadFile(seen + ".2")
+	require.NoError(t, err)
+	assert.Equal(t, "# vipe: invalid JSON: line 2, column 1: unexpected end of JSON input\n"+
+		"# vipe: Fix the error, or empty the buffer to abort.\n"+
+		"[\n", string(reopened))
+}
+
+func TestVipeBuffer(t *testing.T) {
+	t.Run("temp dir", func(t *testing.T) {
+		temp := t.TempDir()
+		t.Setenv("VISUAL", "")
+		t.Setenv("EDITOR", `sh -c '{ ls -ld "$(dirname "$0")"; ls -l "$0"; } | cut -c1-10 > "$0"'`)
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetArgs([]string{"--temp-dir", temp})
+		cmd.SetIn(strings.NewReader("secret\n"))
+		var stdout strings.Builder
+		cmd.SetOut(&stdout)
+		require.NoError(t, cmd.Execute())
+		assert.Equal(t, "drwx------\n-rw-------\n", stdout.String())
+
+		entries, err := os.ReadDir(temp)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("memfd", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("memfd is only supported on Linux")
+		}
+		t.Setenv("VISUAL", "")
+		t.Setenv("EDITOR", `sh -c 'echo "$0" > "$0"'`)
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetArgs([]string{"--memfd"})
+		cmd.SetIn(strings.NewReader("secret\n"))
+		var stdout strings.Builder
+		cmd.SetOut(&stdout)
+		require.NoError(t, cmd.Execute())
+		assert.Regexp(t, `^/proc/[0-9]+/fd/[0-9]+\n$`, stdout.String())
+	})
+}
+
+func TestVipeInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(path, []byte("test\n"), 0o640))
+
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", `sh -c 'echo edited > "$0"'`)
+	cmd := New(cmdutil.DisableTTY())
+	cmd.SetArgs([]string{"--in-place", path})
+	var stdout strings.Builder
+	cmd.SetOut(&stdout)
+	require.NoError(t, cmd.Execute())
+	assert.Empty(t, stdout.String())
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "edited\n", string(b))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+	t.Run("no file", func(t *testing.T) {
+		cmd := New(cmdutil.DisableTTY())
+		cmd.SetArgs([]string{"--in-place"})
+		require.ErrorIs(t, cmd.Execute(), ErrNoFile)
+	})
+}
+
+func errorIs(target error) require.ErrorAssertionFunc {
+	return func(t require.TestingT, err error, msgAndArgs ...any) {
+		require.ErrorIs(t, err, target, msgAndArgs...)
+	}
+}
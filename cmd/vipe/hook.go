@@ -0,0 +1,118 @@
+package vipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gabe565.com/moreutils/internal/editor"
+)
+
+// hook transforms the buffer before and after it is edited.
+type hook struct {
+	// suffix is the default temp file extension.
+	suffix string
+	// pre is applied to the input before the editor is opened.
+	// If it fails, the input is edited as-is with the error shown.
+	pre func([]byte) ([]byte, error)
+	// post is applied to the edited buffer.
+	// If it fails, the editor is reopened with the error shown.
+	post func([]byte) ([]byte, error)
+}
+
+var ErrInvalidJSON = errors.New("invalid JSON")
+
+// jsonHook pretty-prints JSON before editing and validates it after.
+// If minify is true, the edited JSON is compacted.
+func jsonHook(minify bool) *hook {
+	return &hook{
+		suffix: ".json",
+		pre: func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			// Indent keeps trailing whitespace, which would follow the added newline
+			if err := json.Indent(&buf, bytes.TrimRight(data, " \t\r\n"), "", "  "); err != nil {
+				return nil, jsonError(data, err)
+			}
+			buf.WriteByte('\n')
+			return buf.Bytes(), nil
+		},
+		post: func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, data); err != nil {
+				return nil, jsonError(data, err)
+			}
+			if !minify {
+				return data, nil
+			}
+			buf.WriteByte('\n')
+			return buf.Bytes(), nil
+		},
+	}
+}
+
+// jsonError adds the line and column of a syntax error.
+func jsonError(data []byte, err error) error {
+	if syntaxErr, ok := errors.AsType[*json.SyntaxError](err); ok {
+		before := data[:min(syntaxErr.Offset, int64(len(data)))]
+		err = &positionError{
+			pos: editor.Position{
+				Line:   bytes.Count(before, []byte("\n")) + 1,
+				Column: len(before) - bytes.LastIndexByte(before, '\n'),
+			},
+			err: err,
+		}
+	}
+	return fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+}
+
+// positionError is an error at a position in the buffer.
+type positionError struct {
+	pos editor.Position
+	err error
+}
+
+func (e *positionError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %v", e.pos.Line, e.pos.Column, e.err)
+}
+
+func (e *positionError) Unwrap() error { return e.err }
+
+// errorPosition returns the position of an error in a buffer written by withHeader.
+func errorPosition(err error) editor.Position {
+	if posErr, ok := errors.AsType[*positionError](err); ok {
+		pos := posErr.pos
+		pos.Line += bytes.Count(withHeader(nil, err), []byte("\n"))
+		return pos
+	}
+	return editor.Position{}
+}
+
+const headerPrefix = "# "
+
+// withHeader prepends an error to the buffer as comment lines. If err is nil, data is returned unchanged.
+func withHeader(data []byte, err error) []byte {
+	if err == nil {
+		return data
+	}
+
+	var buf bytes.Buffer
+	for line := range strings.Lines(err.Error() + "\nFix the error, or empty the buffer to abort.\n") {
+		buf.WriteString(headerPrefix + "vipe: " + line)
+	}
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// stripHeader removes leading comment lines added by withHeader.
+func stripHeader(data []byte) []byte {
+	for bytes.HasPrefix(data, []byte(headerPrefix+"vipe: ")) {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			return nil
+		}
+		data = data[i+1:]
+	}
+	return data
+}
@@ -0,0 +1,19 @@
+package vipe
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// createMemfd creates an anonymous memory-backed file.
+// The returned path can be opened by child processes while the file is open.
+func createMemfd(name string) (*os.File, string, error) {
+	fd, err := unix.MemfdCreate(name, unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, "", os.NewSyscallError("memfd_create", err)
+	}
+	path := "/proc/" + strconv.Itoa(os.Getpid()) + "/fd/" + strconv.Itoa(fd)
+	return os.NewFile(uintptr(fd), name), path, nil
+}
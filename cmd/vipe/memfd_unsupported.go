@@ -0,0 +1,14 @@
+//go:build !linux
+
+package vipe
+
+import (
+	"errors"
+	"os"
+)
+
+var ErrMemfdUnsupported = errors.New("memfd is only supported on Linux")
+
+func createMemfd(_ string) (*os.File, string, error) {
+	return nil, "", ErrMemfdUnsupported
+}
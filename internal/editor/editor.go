@@ -7,32 +7,68 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/google/shlex"
 	"github.com/mattn/go-tty"
 )
 
 const (
-	envEditor     = "EDITOR"
-	envVisual     = "VISUAL"
-	defaultEditor = "vim"
+	envEditor = "EDITOR"
+	envVisual = "VISUAL"
 )
 
-var ErrUnset = errors.New("env is not set")
+var (
+	ErrUnset    = errors.New("env is not set")
+	ErrNotFound = errors.New("no editor found")
+)
+
+// fallbacks are searched for in PATH if neither VISUAL nor EDITOR is set.
+func fallbacks() []string {
+	return []string{"sensible-editor", "editor", "nano", "vi"}
+}
+
+// waitFlags maps GUI editors to the flags which make them block until the file is closed.
+// The first flag is added if none are present.
+func waitFlags() map[string][]string {
+	return map[string][]string{
+		"atom":          {"--wait", "-w"},
+		"bbedit":        {"--wait", "-w"},
+		"code":          {"--wait", "-w"},
+		"code-insiders": {"--wait", "-w"},
+		"codium":        {"--wait", "-w"},
+		"gvim":          {"--nofork", "-f"},
+		"kate":          {"--block", "-b"},
+		"mate":          {"--wait", "-w"},
+		"mvim":          {"--nofork", "-f"},
+		"subl":          {"--wait", "-w"},
+		"zed":           {"--wait", "-w"},
+	}
+}
 
 // Get checks VISUAL and EDITOR and returns the first result.
-// If neither is set, it will return "vim".
+// If neither is set, the first of sensible-editor, editor, nano, and vi found in PATH is returned.
+// Known GUI editors are given a flag which makes them wait for the file to be closed.
 func Get() ([]string, error) {
 	var errs []error
-	for _, env := range []string{envEditor, envVisual} {
+	for _, env := range []string{envVisual, envEditor} {
 		if editor, err := parseEnv(env); err == nil {
-			return editor, errors.Join(errs...)
+			return addWaitFlag(editor), errors.Join(errs...)
 		} else if !errors.Is(err, ErrUnset) {
 			errs = append(errs, err)
 		}
 	}
 
-	return []string{defaultEditor}, errors.Join(errs...)
+	for _, name := range fallbacks() {
+		if path, err := exec.LookPath(name); err == nil {
+			return []string{path}, errors.Join(errs...)
+		}
+	}
+
+	errs = append(errs, ErrNotFound)
+	return nil, errors.Join(errs...)
 }
 
 func parseEnv(env string) ([]string, error) {
@@ -48,15 +84,36 @@ func parseEnv(env string) ([]string, error) {
 	return nil, fmt.Errorf("parse %s: %w", env, ErrUnset)
 }
 
+// addWaitFlag adds a known GUI editor's wait flag if it is not already present.
+func addWaitFlag(editor []string) []string {
+	name := strings.TrimSuffix(filepath.Base(editor[0]), ".exe")
+	flags, ok := waitFlags()[name]
+	if !ok || slices.ContainsFunc(editor[1:], func(arg string) bool {
+		return slices.Contains(flags, arg)
+	}) {
+		return editor
+	}
+	return slices.Insert(slices.Clone(editor), 1, flags[0])
+}
+
 // Edit opens the configured editor with the given path.
 // If forceTTY is true, "/dev/tty" will be opened for stdin and stdout.
 func Edit(ctx context.Context, path string, forceTTY bool) error {
+	return EditFiles(ctx, []string{path}, Position{}, forceTTY)
+}
+
+// EditFiles opens the configured editor with the given paths.
+// If pos is set, the cursor is placed at that position in the first path.
+// If forceTTY is true, "/dev/tty" will be opened for stdin and stdout.
+func EditFiles(ctx context.Context, paths []string, pos Position, forceTTY bool) error {
 	editor, err := Get()
-	if err != nil {
+	if editor == nil {
+		return err
+	} else if err != nil {
 		slog.Warn("Failed to parse editor envs", "error", err)
 	}
 
-	editor = append(editor, path)
+	editor = Args(editor, paths, pos)
 
 	cmd := exec.CommandContext(ctx, editor[0], editor[1:]...)
 	cmd.Stdin = os.Stdin
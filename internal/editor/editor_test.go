@@ -1,6 +1,8 @@
 package editor
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,16 +12,21 @@ import (
 func TestGet(t *testing.T) {
 	tests := []struct {
 		name    string
+		visual  string
 		env     string
 		want    []string
 		wantErr require.ErrorAssertionFunc
 	}{
-		{"default", "", []string{"vim"}, require.NoError},
-		{"vim", "/usr/bin/vim", []string{"/usr/bin/vim"}, require.NoError},
-		{"vscode", "code --wait --new-window", []string{"code", "--wait", "--new-window"}, require.NoError},
+		{"vim", "", "/usr/bin/vim", []string{"/usr/bin/vim"}, require.NoError},
+		{"vscode", "", "code --wait --new-window", []string{"code", "--wait", "--new-window"}, require.NoError},
+		{"visual", "nvim", "nano", []string{"nvim"}, require.NoError},
+		{"vscode wait", "", "code --new-window", []string{"code", "--wait", "--new-window"}, require.NoError},
+		{"sublime wait", "/usr/local/bin/subl", "", []string{"/usr/local/bin/subl", "--wait"}, require.NoError},
+		{"sublime short wait", "", "subl -w", []string{"subl", "-w"}, require.NoError},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("VISUAL", tt.visual)
 			t.Setenv("EDITOR", tt.env)
 			got, err := Get()
 			tt.wantErr(t, err)
@@ -27,3 +34,46 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestGetFallback(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+
+	temp := t.TempDir()
+	t.Setenv("PATH", temp)
+
+	_, err := Get()
+	require.ErrorIs(t, err, ErrNotFound)
+
+	for _, name := range []string{"vi", "nano"} {
+		require.NoError(t, os.WriteFile(filepath.Join(temp, name), nil, 0o755))
+	}
+
+	got, err := Get()
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(temp, "nano")}, got)
+}
+
+func TestArgs(t *testing.T) {
+	paths := []string{"a.txt", "b.txt"}
+	tests := []struct {
+		name   string
+		editor []string
+		pos    Position
+		want   []string
+	}{
+		{"no position", []string{"vim"}, Position{}, []string{"vim", "a.txt", "b.txt"}},
+		{"vim", []string{"/usr/bin/vim"}, Position{Line: 3, Column: 5}, []string{"/usr/bin/vim", "+call cursor(3, 5)", "a.txt", "b.txt"}},
+		{"nano", []string{"nano"}, Position{Line: 3}, []string{"nano", "+3,1", "a.txt", "b.txt"}},
+		{"emacs", []string{"emacs", "-nw"}, Position{Line: 3, Column: 5}, []string{"emacs", "-nw", "+3:5", "a.txt", "b.txt"}},
+		{"helix", []string{"hx"}, Position{Line: 3, Column: 5}, []string{"hx", "a.txt:3:5", "b.txt"}},
+		{"vscode", []string{"code", "--wait"}, Position{Line: 3, Column: 5}, []string{"code", "--wait", "--goto", "a.txt:3:5", "b.txt"}},
+		{"vi", []string{"vi"}, Position{Line: 3, Column: 5}, []string{"vi", "+3", "a.txt", "b.txt"}},
+		{"unknown", []string{"sh", "-c", "true"}, Position{Line: 3, Column: 5}, []string{"sh", "-c", "true", "a.txt", "b.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Args(tt.editor, paths, tt.pos))
+		})
+	}
+}
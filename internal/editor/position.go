@@ -0,0 +1,97 @@
+package editor
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Position is a location in a file. Lines and columns start at 1.
+// A zero Line means no position, and a zero Column means the start of the line.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// positionStyle describes how an editor accepts a position.
+type positionStyle uint8
+
+const (
+	// stylePlus passes "+line" before the path.
+	stylePlus positionStyle = iota
+	// stylePlusColon passes "+line:column" before the path.
+	stylePlusColon
+	// stylePlusComma passes "+line,column" before the path.
+	stylePlusComma
+	// styleVim passes "+call cursor(line, column)" before the path.
+	styleVim
+	// styleSuffix appends ":line:column" to the path.
+	styleSuffix
+	// styleGoto passes "--goto path:line:column".
+	styleGoto
+)
+
+// positionStyles maps editors to the way they accept a position. Unknown editors are not given a position.
+func positionStyles() map[string]positionStyle {
+	return map[string]positionStyle{
+		"vi":            stylePlus,
+		"view":          stylePlus,
+		"ex":            stylePlus,
+		"joe":           stylePlus,
+		"mg":            stylePlus,
+		"jed":           stylePlus,
+		"emacs":         stylePlusColon,
+		"emacsclient":   stylePlusColon,
+		"kak":           stylePlusColon,
+		"micro":         stylePlusColon,
+		"nano":          stylePlusComma,
+		"vim":           styleVim,
+		"nvim":          styleVim,
+		"gvim":          styleVim,
+		"mvim":          styleVim,
+		"hx":            styleSuffix,
+		"helix":         styleSuffix,
+		"subl":          styleSuffix,
+		"zed":           styleSuffix,
+		"code":          styleGoto,
+		"code-insiders": styleGoto,
+		"codium":        styleGoto,
+	}
+}
+
+// Args returns the editor command with the given paths appended.
+// If pos is set and the editor is known, it is translated to the editor's convention and applied to the first path.
+func Args(editor, paths []string, pos Position) []string {
+	args := slices.Clone(editor)
+	if len(paths) == 0 {
+		return args
+	}
+	if pos.Line <= 0 {
+		return append(args, paths...)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(editor[0]), ".exe")
+	style, ok := positionStyles()[name]
+	if !ok {
+		return append(args, paths...)
+	}
+
+	line := strconv.Itoa(pos.Line)
+	col := strconv.Itoa(max(pos.Column, 1))
+	switch style {
+	case stylePlusColon:
+		args = append(args, "+"+line+":"+col, paths[0])
+	case stylePlusComma:
+		args = append(args, "+"+line+","+col, paths[0])
+	case styleVim:
+		args = append(args, "+call cursor("+line+", "+col+")", paths[0])
+	case styleSuffix:
+		args = append(args, paths[0]+":"+line+":"+col)
+	case styleGoto:
+		args = append(args, "--goto", paths[0]+":"+line+":"+col)
+	case stylePlus:
+		args = append(args, "+"+line, paths[0])
+	}
+	return append(args, paths[1:]...)
+}
@@ -1,30 +1,79 @@
 package execbuf
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"iter"
 	"os/exec"
+	"runtime"
 	"slices"
 	"sync"
 	"time"
 )
 
+// DefaultMemoryLimit is the number of bytes held in memory before older writes spill to a temp file.
+const DefaultMemoryLimit = 8 << 20
+
 // Buffer is an io.Writer that buffers exec.Cmd output.
-// Writes contain timestamp and source metadata so the output can be replayed.
+// Writes are appended in order under a single lock, and contain sequence, timestamp,
+// and source metadata so the output can be replayed.
+//
+// Recent writes are held in memory. Once they exceed the memory limit, the oldest writes spill to a temp file,
+// so that unbounded output does not exhaust memory. If a tail limit is set, the oldest output is dropped instead.
 type Buffer struct {
-	writes []write
-	mu     sync.Mutex
-	wg     sync.WaitGroup
+	memoryLimit int
+	tailBytes   int64
+	tailLines   int64
+	tempDir     string
+	lines       bool
+	pty         bool
+
+	mu      sync.Mutex
+	seq     uint64
+	sources []io.Writer
+	// lens is the number of bytes held for each source.
+	lens []int64
+	// pending holds each source's incomplete line if lines is true.
+	pending []pendingLine
+
+	// mem holds the newest writes.
+	mem     []write
+	memSize int
+
+	// spill holds writes which no longer fit in memory.
+	spill *spillFile
+
+	// skip is the number of bytes which were trimmed from the start of the oldest write.
+	skip int
+	// size is the number of bytes held.
+	size int64
+	// newlines is the number of newlines held.
+	newlines int64
+	// partial is true if the last write did not end with a newline.
+	partial bool
 }
 
 var (
 	ErrStdoutSet = errors.New("stdout already set")
 	ErrStderrSet = errors.New("stderr already set")
 	ErrStarted   = errors.New("exec buffer after process started")
+
+	ErrPTYUnsupported = errors.New("pseudo-terminals are unsupported on " + runtime.GOOS)
 )
 
+// New creates a Buffer. A zero Buffer is also ready to use with the default options.
+func New(opts ...Option) *Buffer {
+	b := &Buffer{}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
 // RunBuffered runs the provided exec.Cmd with buffered stdout/stderr streams.
-func RunBuffered(cmd *exec.Cmd, stdout, stderr io.Writer) (*Buffer, error) {
+// The returned Buffer should be closed once it is no longer needed.
+func RunBuffered(cmd *exec.Cmd, stdout, stderr io.Writer, opts ...Option) (*Buffer, error) {
 	if cmd.Stdout != nil {
 		return nil, ErrStdoutSet
 	}
@@ -35,108 +84,440 @@ func RunBuffered(cmd *exec.Cmd, stdout, stderr io.Writer) (*Buffer, error) {
 		return nil, ErrStarted
 	}
 
-	buf := &Buffer{}
-	cmd.Stdout = buf.Writer(stdout)
+	buf := New(opts...)
 	cmd.Stderr = buf.Writer(stderr)
-	err := cmd.Run()
+	if !buf.pty {
+		cmd.Stdout = buf.Writer(stdout)
+		err := cmd.Run()
+		return buf, err
+	}
+
+	wait, err := StartPTY(cmd, buf.Writer(stdout))
+	if err != nil {
+		return buf, err
+	}
+	err = cmd.Wait()
+	if waitErr := wait(); err == nil {
+		err = waitErr
+	}
 	return buf, err
 }
 
 // write represents a single write.
 type write struct {
+	seq    uint64
 	ts     time.Time
-	source io.Writer
+	source int
 	data   []byte
 }
 
 // Writer creates an BufferWriter which writes to the provided stream.
 func (e *Buffer) Writer(f io.Writer) *BufferWriter {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	return &BufferWriter{
 		Buffer: e,
-		source: f,
+		source: e.sourceIndex(f, true),
 	}
 }
 
-// Close waits for all in-flight writes to finish, then sorts them by timestamp.
-func (e *Buffer) Close() {
-	e.wg.Wait()
+// sourceIndex returns the index of a source. If add is true, unknown sources are registered.
+// It returns -1 for unknown sources.
+func (e *Buffer) sourceIndex(f io.Writer, add bool) int {
+	if i := slices.Index(e.sources, f); i != -1 {
+		return i
+	}
+	if !add {
+		return -1
+	}
+	e.sources = append(e.sources, f)
+	e.lens = append(e.lens, 0)
+	e.pending = append(e.pending, pendingLine{})
+	return len(e.sources) - 1
+}
 
+// Close removes the spill file and discards all buffered output.
+func (e *Buffer) Close() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	slices.SortStableFunc(e.writes, func(a, b write) int {
-		return a.ts.Compare(b.ts)
-	})
+	var err error
+	if e.spill != nil {
+		err = e.spill.Close()
+		e.spill = nil
+	}
+	e.mem, e.memSize = nil, 0
+	e.skip, e.size, e.newlines, e.partial = 0, 0, 0, false
+	clear(e.lens)
+	clear(e.pending)
+	return err
 }
 
 // Print prints output for a source, or all sources if nil.
 func (e *Buffer) Print(source io.Writer) error {
-	e.Close()
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
 	var errs []error
-	for _, write := range e.writes {
-		if source == nil || write.source == source {
-			if _, err := write.source.Write(write.data); err != nil {
-				errs = append(errs, err)
-			}
+	for rec, err := range e.All(sourceFilter(source)...) {
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if _, err := rec.Source.Write(rec.Data); err != nil {
+			errs = append(errs, err)
 		}
 	}
-
 	return errors.Join(errs...)
 }
 
 // Bytes returns the bytes for a source, or all sources if nil.
 func (e *Buffer) Bytes(source io.Writer) []byte {
-	e.Close()
 	buf := make([]byte, 0, e.Len(source))
-	e.mu.Lock()
-	defer e.mu.Unlock()
-
-	for _, write := range e.writes {
-		if source == nil || write.source == source {
-			buf = append(buf, write.data...)
+	for rec, err := range e.All(sourceFilter(source)...) {
+		if err != nil {
+			break
 		}
+		buf = append(buf, rec.Data...)
 	}
 	return buf
 }
 
+// Record is a single write.
+type Record struct {
+	// Seq is the write's sequence number. It increases with each write to the Buffer.
+	Seq    uint64
+	Time   time.Time
+	Source io.Writer
+	// Data must not be modified.
+	Data []byte
+}
+
+// All returns an iterator over the writes in the order they were made,
+// for the given sources or all sources if none are given.
+// The Buffer is locked during iteration, so it must not be written to from the loop body.
+// Iteration stops after the first error.
+func (e *Buffer) All(sources ...io.Writer) iter.Seq2[Record, error] {
+	return func(yield func(Record, error) bool) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		if err := e.flushLines(); err != nil {
+			yield(Record{}, err)
+			return
+		}
+
+		for w, err := range e.writes(sources) {
+			if err != nil {
+				yield(Record{}, err)
+				return
+			}
+			if !yield(Record{Seq: w.seq, Time: w.ts, Source: e.sources[w.source], Data: w.data}, nil) {
+				return
+			}
+		}
+	}
+}
+
+// sourceFilter converts a source, or nil for all sources, to an All filter.
+func sourceFilter(source io.Writer) []io.Writer {
+	if source == nil {
+		return nil
+	}
+	return []io.Writer{source}
+}
+
 // Len returns the number of bytes written for a source, or all sources if nil.
 func (e *Buffer) Len(source io.Writer) int64 {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	var n int64
-	for _, write := range e.writes {
-		if source == nil || write.source == source {
-			n += int64(len(write.data))
+	_ = e.flushLines()
+	if source == nil {
+		return e.size
+	}
+	if i := e.sourceIndex(source, false); i != -1 {
+		return e.lens[i]
+	}
+	return 0
+}
+
+// writes returns an iterator over the held writes for the given sources, or all sources if none are given.
+func (e *Buffer) writes(sources []io.Writer) iter.Seq2[write, error] {
+	var want []bool
+	if len(sources) != 0 {
+		want = make([]bool, len(e.sources))
+		for _, source := range sources {
+			if i := e.sourceIndex(source, false); i != -1 {
+				want[i] = true
+			}
+		}
+	}
+
+	return func(yield func(write, error) bool) {
+		first := true
+		visit := func(w write, err error) bool {
+			if err != nil {
+				return yield(w, err)
+			}
+			if first {
+				w.data = w.data[e.skip:]
+				first = false
+			}
+			if want == nil || want[w.source] {
+				return yield(w, nil)
+			}
+			return true
+		}
+
+		if e.spill != nil {
+			for w, err := range e.spill.all() {
+				if !visit(w, err) || err != nil {
+					return
+				}
+			}
+		}
+		for _, w := range e.mem {
+			if !visit(w, nil) {
+				return
+			}
 		}
 	}
-	return n
+}
+
+// append adds a write, then applies the tail and memory limits.
+func (e *Buffer) append(w write) error {
+	e.seq++
+	w.seq = e.seq
+	e.mem = append(e.mem, w)
+	e.memSize += len(w.data)
+	e.size += int64(len(w.data))
+	e.lens[w.source] += int64(len(w.data))
+	e.newlines += int64(bytes.Count(w.data, []byte("\n")))
+	e.partial = w.data[len(w.data)-1] != '\n'
+
+	if err := e.trim(); err != nil {
+		return err
+	}
+
+	limit := e.memoryLimit
+	if limit <= 0 {
+		limit = DefaultMemoryLimit
+	}
+	for e.memSize > limit && len(e.mem) > 1 {
+		if e.spill == nil {
+			var err error
+			if e.spill, err = newSpillFile(e.tempDir); err != nil {
+				return err
+			}
+		}
+		if err := e.spill.push(e.mem[0]); err != nil {
+			return err
+		}
+		e.memSize -= len(e.mem[0].data)
+		e.mem = slices.Delete(e.mem, 0, 1)
+	}
+	return nil
+}
+
+// lineCount returns the number of lines held, including an incomplete last line.
+func (e *Buffer) lineCount() int64 {
+	if e.partial && e.size != 0 {
+		return e.newlines + 1
+	}
+	return e.newlines
+}
+
+// trim drops the oldest output until the tail limits are satisfied.
+func (e *Buffer) trim() error {
+	for {
+		var excessBytes, excessLines int64
+		if e.tailBytes > 0 {
+			excessBytes = e.size - e.tailBytes
+		}
+		if e.tailLines > 0 {
+			excessLines = e.lineCount() - e.tailLines
+		}
+		if excessBytes <= 0 && excessLines <= 0 {
+			return nil
+		}
+
+		head, err := e.head()
+		if err != nil {
+			return err
+		}
+		data := head.data[e.skip:]
+
+		n := int(min(max(excessBytes, 0), int64(len(data))))
+		if excessLines > 0 {
+			// Drop through the excess newline, or the whole write if it has fewer newlines
+			end := len(data)
+			for i, remaining := 0, excessLines; remaining > 0; remaining-- {
+				j := bytes.IndexByte(data[i:], '\n')
+				if j == -1 {
+					break
+				}
+				i += j + 1
+				end = i
+			}
+			n = max(n, end)
+		}
+
+		dropped := data[:n]
+		e.size -= int64(n)
+		e.lens[head.source] -= int64(n)
+		e.newlines -= int64(bytes.Count(dropped, []byte("\n")))
+
+		if n < len(data) {
+			e.skip += n
+			return nil
+		}
+
+		e.skip = 0
+		if e.spill != nil && e.spill.count != 0 {
+			if err := e.spill.pop(); err != nil {
+				return err
+			}
+		} else {
+			e.memSize -= len(head.data)
+			e.mem = slices.Delete(e.mem, 0, 1)
+		}
+	}
+}
+
+// head returns the oldest write.
+func (e *Buffer) head() (write, error) {
+	if e.spill != nil && e.spill.count != 0 {
+		return e.spill.head()
+	}
+	return e.mem[0], nil
 }
 
 // BufferWriter handles writes to a given source.
 type BufferWriter struct {
 	*Buffer
-	source io.Writer
+	source int
 }
 
 // Write writes bytes for a source to the parent Buffer.
 func (e *BufferWriter) Write(p []byte) (int, error) {
-	ts := time.Now()
-	data := slices.Clone(p)
+	if len(p) == 0 {
+		return 0, nil
+	}
 
-	e.wg.Go(func() {
-		e.mu.Lock()
-		defer e.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
-		e.writes = append(e.writes, write{
-			ts:     ts,
+	var err error
+	if e.lines {
+		err = e.appendLines(e.source, p)
+	} else {
+		err = e.append(write{
+			ts:     time.Now(),
 			source: e.source,
-			data:   data,
+			data:   slices.Clone(p),
 		})
-	})
-
+	}
+	if err != nil {
+		return 0, err
+	}
 	return len(p), nil
 }
+
+// pendingLine is an incomplete line held back by WithLines.
+type pendingLine struct {
+	ts   time.Time
+	data []byte
+}
+
+// appendLines adds each complete line as a separate write, holding back an incomplete last line.
+// Each line is timestamped with the time its first byte was written.
+func (e *Buffer) appendLines(source int, p []byte) error {
+	now := time.Now()
+	pending := &e.pending[source]
+	for len(p) != 0 {
+		if len(pending.data) == 0 {
+			pending.ts = now
+		}
+
+		i := bytes.IndexByte(p, '\n')
+		if i == -1 {
+			pending.data = append(pending.data, p...)
+			return nil
+		}
+
+		line := append(pending.data, p[:i+1]...)
+		pending.data = nil
+		if err := e.append(write{ts: pending.ts, source: source, data: line}); err != nil {
+			return err
+		}
+		p = p[i+1:]
+	}
+	return nil
+}
+
+// flushLines adds the incomplete lines held back by WithLines, oldest first.
+func (e *Buffer) flushLines() error {
+	for {
+		source := -1
+		for i, pending := range e.pending {
+			if len(pending.data) != 0 && (source == -1 || pending.ts.Before(e.pending[source].ts)) {
+				source = i
+			}
+		}
+		if source == -1 {
+			return nil
+		}
+
+		pending := &e.pending[source]
+		w := write{ts: pending.ts, source: source, data: pending.data}
+		pending.data = nil
+		if err := e.append(w); err != nil {
+			return err
+		}
+	}
+}
+
+// Option configures a Buffer.
+type Option func(*Buffer)
+
+// WithMemoryLimit sets the number of bytes held in memory before older writes spill to a temp file.
+func WithMemoryLimit(n int) Option {
+	return func(b *Buffer) {
+		b.memoryLimit = n
+	}
+}
+
+// WithTempDir sets the directory for the spill file. The default is os.TempDir.
+func WithTempDir(dir string) Option {
+	return func(b *Buffer) {
+		b.tempDir = dir
+	}
+}
+
+// WithLines records output a line at a time. Incomplete lines are held back until they are
+// completed, or until the Buffer is read.
+func WithLines() Option {
+	return func(b *Buffer) {
+		b.lines = true
+	}
+}
+
+// WithPTY makes RunBuffered connect the command's stdout to a pseudo-terminal. See StartPTY.
+func WithPTY() Option {
+	return func(b *Buffer) {
+		b.pty = true
+	}
+}
+
+// WithTailBytes keeps only the last n bytes of output. 0 keeps everything.
+func WithTailBytes(n int64) Option {
+	return func(b *Buffer) {
+		b.tailBytes = n
+	}
+}
+
+// WithTailLines keeps only the last n lines of output. 0 keeps everything.
+func WithTailLines(n int64) Option {
+	return func(b *Buffer) {
+		b.tailLines = n
+	}
+}
@@ -0,0 +1,146 @@
+package execbuf
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuffer(t *testing.T) {
+	writes := []string{"a\n", "b", "b\nc", "c\n", "d\n", "eee"}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		want       string
+		wantStdout string
+	}{
+		{"all", nil, "a\nbb\ncc\nd\neee", "a\nb\ncd\n"},
+		{"spill", []Option{WithMemoryLimit(1)}, "a\nbb\ncc\nd\neee", "a\nb\ncd\n"},
+		{"tail lines", []Option{WithTailLines(2)}, "d\neee", "d\n"},
+		{"tail lines partial write", []Option{WithTailLines(3)}, "cc\nd\neee", "cd\n"},
+		{"tail lines spill", []Option{WithTailLines(3), WithMemoryLimit(1)}, "cc\nd\neee", "cd\n"},
+		{"tail bytes", []Option{WithTailBytes(5)}, "d\neee", "d\n"},
+		{"tail bytes spill", []Option{WithTailBytes(6), WithMemoryLimit(1)}, "\nd\neee", "d\n"},
+		{"tail both", []Option{WithTailBytes(4), WithTailLines(3)}, "\neee", "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			buf := New(append(tt.opts, WithTempDir(dir))...)
+
+			var stdout, stderr strings.Builder
+			outW, errW := buf.Writer(&stdout), buf.Writer(&stderr)
+			for i, s := range writes {
+				w := outW
+				if i%2 == 1 {
+					w = errW
+				}
+				_, err := w.Write([]byte(s))
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, string(buf.Bytes(nil)))
+			assert.Equal(t, tt.wantStdout, string(buf.Bytes(&stdout)))
+			assert.EqualValues(t, len(tt.want), buf.Len(nil))
+			assert.EqualValues(t, len(tt.wantStdout), buf.Len(&stdout))
+
+			require.NoError(t, buf.Print(nil))
+			assert.Equal(t, tt.wantStdout, stdout.String())
+			assert.Equal(t, len(tt.want)-len(tt.wantStdout), stderr.Len())
+
+			require.NoError(t, buf.Close())
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestBufferAll(t *testing.T) {
+	buf := New(WithMemoryLimit(4), WithTempDir(t.TempDir()))
+	t.Cleanup(func() { _ = buf.Close() })
+
+	var stdout, stderr, other strings.Builder
+	outW, errW := buf.Writer(&stdout), buf.Writer(&stderr)
+	for _, w := range []*BufferWriter{outW, errW, outW, errW, outW} {
+		_, err := w.Write([]byte("test"))
+		require.NoError(t, err)
+	}
+
+	var seqs []uint64
+	for rec, err := range buf.All() {
+		require.NoError(t, err)
+		assert.Equal(t, "test", string(rec.Data))
+		seqs = append(seqs, rec.Seq)
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, seqs)
+
+	seqs = seqs[:0]
+	for rec, err := range buf.All(&stderr, &other) {
+		require.NoError(t, err)
+		assert.Same(t, &stderr, rec.Source)
+		seqs = append(seqs, rec.Seq)
+	}
+	assert.Equal(t, []uint64{2, 4}, seqs)
+
+	for range buf.All(&other) {
+		t.Fatal("unexpected record")
+	}
+
+	var n int
+	for range buf.All() {
+		n++
+		break
+	}
+	assert.Equal(t, 1, n)
+}
+
+func TestBufferLines(t *testing.T) {
+	buf := New(WithLines())
+	t.Cleanup(func() { _ = buf.Close() })
+
+	var stdout, stderr strings.Builder
+	outW, errW := buf.Writer(&stdout), buf.Writer(&stderr)
+	for _, write := range []struct {
+		w    *BufferWriter
+		data string
+	}{
+		{outW, "a"},
+		{errW, "x"},
+		{outW, "b\nc"},
+		{errW, "y\n"},
+		{outW, "\nd\n"},
+		{errW, "z"},
+	} {
+		_, err := write.w.Write([]byte(write.data))
+		require.NoError(t, err)
+	}
+
+	var lines []string
+	for rec, err := range buf.All() {
+		require.NoError(t, err)
+		lines = append(lines, string(rec.Data))
+	}
+	assert.Equal(t, []string{"ab\n", "xy\n", "c\n", "d\n", "z"}, lines)
+	assert.Equal(t, "ab\nc\nd\n", string(buf.Bytes(&stdout)))
+}
+
+func TestRunBufferedPTY(t *testing.T) {
+	var stdout, stderr strings.Builder
+	cmd := exec.Command("sh", "-c", `[ -t 1 ] && echo stdout is a terminal; [ -t 2 ] || echo stderr is a pipe >&2`)
+	buf, err := RunBuffered(cmd, &stdout, &stderr, WithPTY(), WithLines())
+	if errors.Is(err, ErrPTYUnsupported) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = buf.Close() })
+
+	assert.Equal(t, "stdout is a terminal\n", string(buf.Bytes(&stdout)))
+	assert.Equal(t, "stderr is a pipe\n", string(buf.Bytes(&stderr)))
+}
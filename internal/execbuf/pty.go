@@ -0,0 +1,71 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package execbuf
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+)
+
+// StartPTY starts a command with its stdout connected to a pseudo-terminal, so that it behaves as it would
+// in an interactive run. Output read from the terminal is written to w. Stdin and stderr are left unchanged.
+//
+// The command is started in a new session, which also gives it a new process group.
+// The returned function must be called after the command is waited on. It waits for the
+// remaining output to be copied, then closes the terminal.
+func StartPTY(cmd *exec.Cmd, w io.Writer) (func() error, error) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tty.Close()
+	}()
+
+	// Write "\n" instead of "\r\n", so output matches what would be written to a file
+	t, err := unix.IoctlGetTermios(int(tty.Fd()), ioctlGetTermios)
+	if err == nil {
+		t.Oflag &^= unix.ONLCR
+		err = unix.IoctlSetTermios(int(tty.Fd()), ioctlSetTermios, t)
+	}
+	if err == nil {
+		err = pty.Setsize(ptmx, &pty.Winsize{Rows: 24, Cols: 80})
+	}
+	if err != nil {
+		_ = ptmx.Close()
+		return nil, err
+	}
+
+	cmd.Stdout = tty
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setpgid = false
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 1
+	if err := cmd.Start(); err != nil {
+		_ = ptmx.Close()
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, ptmx)
+		// Reads fail with EIO once every process has closed the terminal
+		if errors.Is(err, syscall.EIO) {
+			err = nil
+		}
+		done <- err
+	}()
+
+	return func() error {
+		err := <-done
+		return errors.Join(err, ptmx.Close())
+	}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package execbuf
+
+import (
+	"io"
+	"os/exec"
+)
+
+// StartPTY is unsupported on this platform.
+func StartPTY(*exec.Cmd, io.Writer) (func() error, error) {
+	return nil, ErrPTYUnsupported
+}
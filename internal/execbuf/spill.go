@@ -0,0 +1,127 @@
+package execbuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"iter"
+	"os"
+	"time"
+)
+
+// spillHeaderSize is the size of a spilled write's header: sequence number, timestamp, source index, and data length.
+const (
+	spillHeaderSize = 8 + 8 + 2 + 4
+	spillLenOffset  = spillHeaderSize - 4
+)
+
+// spillFile stores writes which no longer fit in memory.
+type spillFile struct {
+	f *os.File
+	// start is the offset of the oldest write.
+	start int64
+	// end is the offset after the newest write.
+	end int64
+	// count is the number of writes held.
+	count int
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "moreutils-execbuf-*")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{f: f}, nil
+}
+
+// push appends a write.
+func (s *spillFile) push(w write) error {
+	buf := make([]byte, spillHeaderSize, spillHeaderSize+len(w.data))
+	binary.LittleEndian.PutUint64(buf, w.seq)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(w.ts.UnixNano()))          //nolint:gosec
+	binary.LittleEndian.PutUint16(buf[16:], uint16(w.source))                //nolint:gosec
+	binary.LittleEndian.PutUint32(buf[spillLenOffset:], uint32(len(w.data))) //nolint:gosec
+	buf = append(buf, w.data...)
+
+	if _, err := s.f.WriteAt(buf, s.end); err != nil {
+		return err
+	}
+	s.end += int64(len(buf))
+	s.count++
+	return nil
+}
+
+// read reads the write at an offset.
+func (s *spillFile) read(off int64) (write, error) {
+	var header [spillHeaderSize]byte
+	if _, err := s.f.ReadAt(header[:], off); err != nil {
+		return write{}, err
+	}
+	w := write{
+		seq:    binary.LittleEndian.Uint64(header[:]),
+		ts:     time.Unix(0, int64(binary.LittleEndian.Uint64(header[8:]))), //nolint:gosec
+		source: int(binary.LittleEndian.Uint16(header[16:])),
+		data:   make([]byte, binary.LittleEndian.Uint32(header[spillLenOffset:])),
+	}
+	if _, err := s.f.ReadAt(w.data, off+spillHeaderSize); err != nil {
+		return write{}, err
+	}
+	return w, nil
+}
+
+// head returns the oldest write.
+func (s *spillFile) head() (write, error) {
+	return s.read(s.start)
+}
+
+// pop removes the oldest write.
+func (s *spillFile) pop() error {
+	var length [4]byte
+	if _, err := s.f.ReadAt(length[:], s.start+spillLenOffset); err != nil {
+		return err
+	}
+	s.start += spillHeaderSize + int64(binary.LittleEndian.Uint32(length[:]))
+	s.count--
+
+	switch {
+	case s.count == 0:
+		s.start, s.end = 0, 0
+		return s.f.Truncate(0)
+	case s.start > s.end-s.start && s.start >= DefaultMemoryLimit:
+		// Most of the file has been dropped, so move the remaining writes to the start
+		return s.compact()
+	}
+	return nil
+}
+
+// compact moves the held writes to the start of the file.
+func (s *spillFile) compact() error {
+	n, err := io.Copy(
+		io.NewOffsetWriter(s.f, 0),
+		io.NewSectionReader(s.f, s.start, s.end-s.start),
+	)
+	if err != nil {
+		return err
+	}
+	s.start, s.end = 0, n
+	return s.f.Truncate(n)
+}
+
+// all returns an iterator over the held writes in order.
+func (s *spillFile) all() iter.Seq2[write, error] {
+	return func(yield func(write, error) bool) {
+		off := s.start
+		for range s.count {
+			w, err := s.read(off)
+			if !yield(w, err) || err != nil {
+				return
+			}
+			off += spillHeaderSize + int64(len(w.data))
+		}
+	}
+}
+
+// Close closes and removes the file.
+func (s *spillFile) Close() error {
+	return errors.Join(s.f.Close(), os.Remove(s.f.Name()))
+}
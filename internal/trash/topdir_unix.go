@@ -0,0 +1,63 @@
+//go:build unix
+
+package trash
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// topDir returns the top directory of the device containing path if it differs from the trash device.
+func topDir(path, trash string) (string, bool) {
+	dev, ok := device(filepath.Dir(path))
+	if !ok {
+		return "", false
+	}
+	if trashDev, ok := device(trash); !ok || trashDev == dev {
+		return "", false
+	}
+
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, true
+		}
+		if parentDev, ok := device(parent); !ok || parentDev != dev {
+			return dir, true
+		}
+		dir = parent
+	}
+}
+
+// topDirTrash returns the trash directory for a top directory.
+// "$topdir/.Trash/$uid" is used if "$topdir/.Trash" is a sticky directory, otherwise "$topdir/.Trash-$uid" is used.
+func topDirTrash(topdir string) (string, error) {
+	uid := strconv.Itoa(os.Getuid())
+
+	shared := filepath.Join(topdir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(shared, uid)
+		if err := os.Mkdir(dir, 0o700); err == nil || errors.Is(err, os.ErrExist) {
+			return dir, nil
+		}
+	}
+
+	dir := filepath.Join(topdir, ".Trash-"+uid)
+	if err := os.Mkdir(dir, 0o700); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+	return dir, nil
+}
+
+func device(path string) (uint64, bool) {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return 0, false
+	}
+	return uint64(stat.Dev), true //nolint:unconvert // Dev is not a uint64 on every platform
+}
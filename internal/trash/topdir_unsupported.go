@@ -0,0 +1,15 @@
+//go:build !unix
+
+package trash
+
+import "errors"
+
+var errTopDirUnsupported = errors.New("trash: top directory trash is not supported on this platform")
+
+func topDir(string, string) (string, bool) {
+	return "", false
+}
+
+func topDirTrash(string) (string, error) {
+	return "", errTopDirUnsupported
+}
@@ -0,0 +1,129 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const infoExt = ".trashinfo"
+
+// Item is an entry which has been moved to the trash.
+type Item struct {
+	// Path is the location of the entry within the trash.
+	Path string
+	// InfoPath is the location of the entry's .trashinfo file.
+	InfoPath string
+	// Original is the absolute path the entry was trashed from.
+	Original string
+}
+
+// HomeDir returns the home trash directory.
+// It is "$XDG_DATA_HOME/Trash", or "~/.local/share/Trash" if XDG_DATA_HOME is unset.
+func HomeDir() (string, error) {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+		return filepath.Join(dataHome, "Trash"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// Put moves a path to the trash following the FreeDesktop.org Trash specification.
+// Entries are moved to the home trash. If the path is on a different device,
+// the trash directory at the top of that device is used instead.
+func Put(path string) (*Item, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := HomeDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	infoPath := abs
+	if topdir, ok := topDir(abs, dir); ok {
+		if dir, err = topDirTrash(topdir); err != nil {
+			return nil, err
+		}
+		if infoPath, err = filepath.Rel(topdir, abs); err != nil {
+			return nil, err
+		}
+	}
+
+	return put(dir, abs, infoPath)
+}
+
+func put(dir, abs, infoPath string) (*Item, error) {
+	filesDir := filepath.Join(dir, "files")
+	infoDir := filepath.Join(dir, "info")
+	for _, dir := range []string{filesDir, infoDir} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, err
+		}
+	}
+
+	base := filepath.Base(abs)
+	for n := 1; ; n++ {
+		name := base
+		if n != 1 {
+			name += "." + strconv.Itoa(n)
+		}
+
+		item := &Item{
+			Path:     filepath.Join(filesDir, name),
+			InfoPath: filepath.Join(infoDir, name+infoExt),
+			Original: abs,
+		}
+
+		// The info file is created exclusively to reserve the name
+		f, err := os.OpenFile(item.InfoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			if errors.Is(err, os.ErrExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: infoPath}).EscapedPath(),
+			time.Now().Format("2006-01-02T15:04:05"),
+		)
+		if err := errors.Join(err, f.Close()); err != nil {
+			return nil, errors.Join(err, os.Remove(item.InfoPath))
+		}
+
+		if _, err := os.Lstat(item.Path); err == nil {
+			// Name is taken by an entry without an info file
+			if err := os.Remove(item.InfoPath); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if err := os.Rename(abs, item.Path); err != nil {
+			return nil, errors.Join(err, os.Remove(item.InfoPath))
+		}
+		return item, nil
+	}
+}
+
+// Restore moves an item back to its original location and removes its info file.
+func (i *Item) Restore() error {
+	if err := os.Rename(i.Path, i.Original); err != nil {
+		return err
+	}
+	return os.Remove(i.InfoPath)
+}
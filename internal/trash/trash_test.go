@@ -0,0 +1,49 @@
+package trash
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPut(t *testing.T) {
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+
+	temp := t.TempDir()
+	path := filepath.Join(temp, "a b")
+	require.NoError(t, os.WriteFile(path, []byte("test"), 0o666))
+
+	item, err := Put(path)
+	require.NoError(t, err)
+	assert.NoFileExists(t, path)
+	assert.Equal(t, filepath.Join(dataHome, "Trash", "files", "a b"), item.Path)
+	assert.Equal(t, filepath.Join(dataHome, "Trash", "info", "a b.trashinfo"), item.InfoPath)
+
+	b, err := os.ReadFile(item.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "test", string(b))
+
+	info, err := os.ReadFile(item.InfoPath)
+	require.NoError(t, err)
+	assert.Regexp(t, `^\[Trash Info\]
+Path=`+filepath.ToSlash(temp)+`/a%20b
+DeletionDate=\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}
+$`, string(info))
+
+	// Duplicate names are suffixed
+	require.NoError(t, os.WriteFile(path, []byte("test2"), 0o666))
+	item2, err := Put(path)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dataHome, "Trash", "files", "a b.2"), item2.Path)
+
+	require.NoError(t, item2.Restore())
+	assert.NoFileExists(t, item2.Path)
+	assert.NoFileExists(t, item2.InfoPath)
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "test2", string(b))
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ReplaceFile buffers writes in a temp file which replaces the target file when committed.
+// If the target file exists, its permissions are preserved.
+type ReplaceFile struct {
+	*os.File
+	path string
+	mode os.FileMode
+	// inPlace is set if the target is not a regular file, so it is written to instead of replaced.
+	inPlace bool
+}
+
+// CreateReplaceFile creates a temp file which will replace path once Commit is called.
+// The temp file is created next to path so that it can be renamed into place atomically.
+// If that directory is not writable, the system temp dir is used instead.
+// Symlinks are resolved so that the link is kept and its target is replaced.
+func CreateReplaceFile(path string) (*ReplaceFile, error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	stat, err := os.Lstat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	pattern := ".moreutils-*-" + filepath.Base(path)
+	tmp, err := os.CreateTemp(filepath.Dir(path), pattern)
+	if err != nil {
+		if tmp, err = os.CreateTemp("", pattern); err != nil {
+			return nil, err
+		}
+	}
+	f := &ReplaceFile{File: tmp, path: path, mode: 0o666}
+
+	switch {
+	case stat != nil && !stat.Mode().IsRegular():
+		// Devices, pipes, and dangling symlinks cannot be renamed over
+		f.inPlace = true
+	case stat != nil:
+		f.mode = stat.Mode()
+		prevUmask := Umask(0)
+		err := tmp.Chmod(f.mode)
+		Umask(prevUmask)
+		if err != nil {
+			return nil, errors.Join(err, f.Close())
+		}
+	}
+	return f, nil
+}
+
+// Commit closes the temp file and renames it over the target file.
+// If the target is not a regular file or the rename fails (e.g. the temp dir is on another filesystem),
+// the contents are copied into the target file instead.
+func (f *ReplaceFile) Commit() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+
+	if !f.inPlace {
+		if err := os.Rename(f.Name(), f.path); err == nil {
+			return nil
+		}
+	}
+
+	// Atomic copy not possible
+	in, err := os.Open(f.Name())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	out, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	return out.Close()
+}
+
+// Close discards the temp file. It is a no-op after a successful Commit.
+func (f *ReplaceFile) Close() error {
+	_ = f.File.Close()
+	if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
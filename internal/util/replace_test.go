@@ -0,0 +1,90 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplaceFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(path, []byte("previous"), 0o600))
+
+	f, err := CreateReplaceFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Dir(path), filepath.Dir(f.Name()))
+	_, err = f.WriteString("replaced")
+	require.NoError(t, err)
+
+	// Target is unchanged until committed
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(b))
+
+	require.NoError(t, f.Commit())
+	require.NoError(t, f.Close())
+	assert.NoFileExists(t, f.Name())
+
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "replaced", string(b))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	t.Run("discard", func(t *testing.T) {
+		f, err := CreateReplaceFile(path)
+		require.NoError(t, err)
+		_, err = f.WriteString("discarded")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		assert.NoFileExists(t, f.Name())
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "replaced", string(b))
+	})
+	t.Run("symlink", func(t *testing.T) {
+		link := filepath.Join(t.TempDir(), "link")
+		require.NoError(t, os.Symlink(path, link))
+
+		f, err := CreateReplaceFile(link)
+		require.NoError(t, err)
+		_, err = f.WriteString("linked")
+		require.NoError(t, err)
+		require.NoError(t, f.Commit())
+		require.NoError(t, f.Close())
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "linked", string(b))
+	})
+
+	t.Run("dangling symlink", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target")
+		link := filepath.Join(dir, "link")
+		require.NoError(t, os.Symlink(target, link))
+
+		f, err := CreateReplaceFile(link)
+		require.NoError(t, err)
+		_, err = f.WriteString("created")
+		require.NoError(t, err)
+		require.NoError(t, f.Commit())
+		require.NoError(t, f.Close())
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+		b, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "created", string(b))
+	})
+}